@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"vcs/svcs"
+)
+
+// ExpandAliases replaces an alias in args[0] with its definition until a
+// built-in command is reached, failing on aliases that refer back to themselves.
+func ExpandAliases(config *svcs.Config, args []string) ([]string, error) {
+	var chain []string
+	for len(args) > 0 {
+		if _, ok := commandsByName[args[0]]; ok {
+			return args, nil
+		}
+		value, ok := config.Alias(args[0])
+		if !ok {
+			return args, nil
+		}
+		for _, name := range chain {
+			if name == args[0] {
+				return nil, usageError("alias loop detected: %s", strings.Join(append(chain, args[0]), " -> "))
+			}
+		}
+		chain = append(chain, args[0])
+		expansion, err := SplitArgs(value)
+		if err != nil {
+			return nil, usageError("bad alias '%s': %v", args[0], err)
+		}
+		if len(expansion) == 0 {
+			return nil, usageError("alias '%s' is empty", args[0])
+		}
+		args = append(expansion, args[1:]...)
+	}
+	return args, nil
+}
+
+// SplitArgs splits s into words separated by whitespace, honouring single
+// quotes, double quotes and backslash escapes.
+func SplitArgs(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in '%s'", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func printAliases(config *svcs.Config) {
+	aliases := config.Aliases()
+	if len(aliases) == 0 {
+		return
+	}
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("")
+	fmt.Println("Aliases:")
+	for _, name := range names {
+		fmt.Printf("%-9s = %s\n", name, aliases[name])
+	}
+}
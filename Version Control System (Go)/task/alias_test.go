@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"  status  --porcelain ", []string{"status", "--porcelain"}, false},
+		{`commit -m "two words"`, []string{"commit", "-m", "two words"}, false},
+		{`log 'it''s'`, []string{"log", "its"}, false},
+		{`a\ b "c\"d" 'e\f'`, []string{"a b", `c"d`, `e\f`}, false},
+		{`""`, []string{""}, false},
+		{`"open`, nil, true},
+		{`trailing\`, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.s)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, %v, want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func FuzzSplitArgs(f *testing.F) {
+	f.Add(`commit -m "two words" 'x y' a\ b`)
+	f.Fuzz(func(t *testing.T, s string) {
+		words, err := SplitArgs(s)
+		if err != nil {
+			return
+		}
+		// Quoting every word again must give the same words back
+		var quoted string
+		for _, word := range words {
+			quoted += ` '` + strings.ReplaceAll(word, `'`, `'\''`) + `'`
+		}
+		again, err := SplitArgs(quoted)
+		if err != nil || !reflect.DeepEqual(again, words) {
+			t.Fatalf("SplitArgs(%q) = %q, %v, want %q", quoted, again, err, words)
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"vcs/svcs"
+)
+
+// Command describes a svcs command: its flags, positional arguments and help text.
+type Command struct {
+	Name    string
+	Summary string
+	// Usage lists the flags and positional arguments, without the command name.
+	Usage   string
+	Help    string
+	MinArgs int
+	// MaxArgs is the maximum number of positional arguments, -1 for no limit.
+	MaxArgs int
+	Run     func(args []string) error
+	// NoRepository is set on commands that run without opening the repository,
+	// which may be in an older format.
+	NoRepository bool
+	// NoFlags passes every argument through as positional, for commands that
+	// run other programs with their own options.
+	NoFlags bool
+
+	flags *flag.FlagSet
+}
+
+var (
+	commands       []*Command
+	commandsByName map[string]*Command
+)
+
+// registerCommands builds the command registry afresh, with every flag at its default.
+func registerCommands() {
+	commands = []*Command{
+		newConfigCommand(),
+		newAddCommand(),
+		newLogCommand(),
+		newReflogCommand(),
+		newShowCommand(),
+		newBlameCommand(),
+		newBisectCommand(),
+		newCommitCommand(),
+		newCheckoutCommand(),
+		newCherryPickCommand(),
+		newRebaseCommand(),
+		newStatusCommand(),
+		newDiffCommand(),
+		newFsckCommand(),
+		newGCCommand(),
+		newCountObjectsCommand(),
+		newUpgradeCommand(),
+		newHelpCommand(),
+	}
+	commandsByName = map[string]*Command{}
+	for _, cmd := range commands {
+		commandsByName[cmd.Name] = cmd
+	}
+}
+
+func (cmd *Command) Flags() *flag.FlagSet {
+	if cmd.flags == nil {
+		cmd.flags = flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+		cmd.flags.SetOutput(io.Discard)
+	}
+	return cmd.flags
+}
+
+// Parse parses flags anywhere among args; everything after "--" is positional.
+func (cmd *Command) Parse(args []string) ([]string, error) {
+	flags := cmd.Flags()
+	var positional []string
+	if cmd.NoFlags {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+			return nil, flag.ErrHelp
+		}
+		positional, args = args, nil
+	}
+	for len(args) > 0 {
+		if args[0] == "--" {
+			positional = append(positional, args[1:]...)
+			break
+		}
+		err := flags.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, cmd.UsageError(err.Error())
+		}
+		consumed := len(args) - flags.NArg()
+		rest := flags.Args()
+		if consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		if len(rest) == 0 {
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	if len(positional) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(positional) > cmd.MaxArgs) {
+		return nil, cmd.UsageError("wrong number of arguments")
+	}
+	return positional, nil
+}
+
+// UsageError reports a misuse of cmd together with its usage line.
+func (cmd *Command) UsageError(message string) error {
+	return usageError("%s\nusage: %s", message, strings.TrimSpace("svcs "+cmd.Name+" "+cmd.Usage))
+}
+
+// Execute runs the command named by args[0] with the remaining arguments.
+func Execute(args []string) error {
+	cmd, ok := commandsByName[args[0]]
+	if !ok {
+		return usageError("'%s' is not a SVCS command", args[0])
+	}
+	if outputFormat != FormatText && !cmd.HasFormats() {
+		return usageError("'%s' does not support --format or --porcelain", cmd.Name)
+	}
+	positional, err := cmd.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		printCommandHelp(cmd)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cmd.Run(positional)
+}
+
+func printHelp(config *svcs.Config) {
+	fmt.Println("These are SVCS commands:")
+	// The summaries line up after the longest name
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.Name))
+	}
+	for _, cmd := range commands {
+		fmt.Printf("%-*s %s\n", width, cmd.Name, cmd.Summary)
+	}
+	printAliases(config)
+}
+
+func printCommandHelp(cmd *Command) {
+	fmt.Printf("usage: svcs %s %s\n", cmd.Name, cmd.Usage)
+	fmt.Println("")
+	fmt.Println(cmd.Summary)
+	if cmd.Help != "" {
+		fmt.Println("")
+		fmt.Println(cmd.Help)
+	}
+	var options []string
+	cmd.Flags().VisitAll(func(f *flag.Flag) {
+		name := "-" + f.Name
+		if len(f.Name) > 1 {
+			name = "-" + name
+		}
+		valueName, usage := flag.UnquoteUsage(f)
+		if valueName != "" {
+			name += " <" + valueName + ">"
+		}
+		options = append(options, fmt.Sprintf("  %-20s %s", name, usage))
+	})
+	if len(options) > 0 {
+		fmt.Println("")
+		fmt.Println("Options:")
+		fmt.Println(strings.Join(options, "\n"))
+	}
+}
+
+func newHelpCommand() *Command {
+	return &Command{
+		Name:    "help",
+		Summary: "Show help for a command.",
+		Usage:   "[<command>]",
+		MaxArgs: 1,
+		Run: func(args []string) error {
+			if len(args) == 0 {
+				printHelp(repo.Config)
+				return nil
+			}
+			cmd, ok := commandsByName[args[0]]
+			if !ok {
+				return usageError("'%s' is not a SVCS command", args[0])
+			}
+			printCommandHelp(cmd)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    []string
+		message string
+		wantErr bool
+	}{
+		{[]string{"a.txt"}, []string{"a.txt"}, "", false},
+		{[]string{"-m", "msg", "a", "b"}, []string{"a", "b"}, "msg", false},
+		{[]string{"a", "--m=msg", "b"}, []string{"a", "b"}, "msg", false},
+		{[]string{"a", "--", "-m"}, []string{"a", "-m"}, "", false},
+		{[]string{"-m", "msg", "--", "-x"}, []string{"-x"}, "msg", false},
+		{[]string{}, nil, "", true},
+		{[]string{"a", "b", "c"}, nil, "", true},
+		{[]string{"-x", "a"}, nil, "", true},
+		{[]string{"a", "-m"}, nil, "", true},
+	}
+	for _, tt := range tests {
+		cmd := &Command{Name: "test", MinArgs: 1, MaxArgs: 2}
+		message := cmd.Flags().String("m", "", "message")
+		got, err := cmd.Parse(tt.args)
+		if tt.wantErr {
+			if !errors.Is(err, ErrUsage) {
+				t.Errorf("Parse(%q) error = %v, want ErrUsage", tt.args, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) || *message != tt.message {
+			t.Errorf("Parse(%q) = %q, -m %q, %v, want %q, -m %q", tt.args, got, *message, err, tt.want, tt.message)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	registerCommands()
+	tests := []struct {
+		err  error
+		want int
+		kind string
+	}{
+		{nil, ExitOK, ""},
+		{errors.New("boom"), ExitFailure, "failure"},
+		{usageError("bad"), ExitUsage, "usage"},
+		{Execute([]string{"nope"}), ExitUsage, "usage"},
+	}
+	for _, tt := range tests {
+		if got := ExitCode(tt.err); got != tt.want {
+			t.Errorf("ExitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+		if tt.err != nil {
+			if got := ErrorKind(tt.err); got != tt.kind {
+				t.Errorf("ErrorKind(%v) = %q, want %q", tt.err, got, tt.kind)
+			}
+		}
+	}
+}
@@ -0,0 +1,1261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"vcs/svcs"
+)
+
+// porcelainCodes are the letters of each state in the two-column porcelain status.
+var porcelainCodes = map[string]string{
+	svcs.StateUnmodified: " ",
+	svcs.StateModified:   "M",
+	svcs.StateAdded:      "A",
+	svcs.StateDeleted:    "D",
+	svcs.StateUntracked:  "?",
+}
+
+func newConfigCommand() *Command {
+	cmd := withFormats(&Command{
+		Name:    "config",
+		Summary: "Get and set configuration options.",
+		Usage:   "[--local | --global | --system] [--type=<type>] (--get <key> | --set <key> <value> | --unset <key> | --list | [<name>])",
+		Help: "Without an action, shows the username or sets it to <name>.\n" +
+			"Reads use every scope unless one is given; writes default to the repository scope.",
+		MaxArgs: 2,
+	})
+	flags := cmd.Flags()
+	local := flags.Bool("local", false, "use the repository configuration file")
+	global := flags.Bool("global", false, "use the user configuration file")
+	system := flags.Bool("system", false, "use the system configuration file")
+	valueType := flags.String("type", svcs.TypeString, "interpret values as `type` string, bool, int or path")
+	get := flags.Bool("get", false, "print the value of a key")
+	set := flags.Bool("set", false, "set a key to a value")
+	unset := flags.Bool("unset", false, "remove a key")
+	list := flags.Bool("list", false, "list all keys and values")
+	cmd.Run = func(args []string) error {
+		config := repo.Config
+		scope := svcs.ScopeRepository
+		scoped := *local || *global || *system
+		switch {
+		case *global:
+			scope = svcs.ScopeUser
+		case *system:
+			scope = svcs.ScopeSystem
+		}
+
+		switch {
+		case *get:
+			if len(args) != 1 {
+				return cmd.UsageError("--get takes exactly one key")
+			}
+			var value string
+			var ok bool
+			var err error
+			if scoped {
+				value, ok = config.Files[scope].Values[args[0]]
+				if ok {
+					value, err = svcs.NormalizeValue(value, *valueType)
+				}
+			} else {
+				value, ok, err = config.GetTyped(args[0], *valueType)
+			}
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("key '%s' is not set", args[0])
+			}
+			return printConfigValue(args[0], value)
+		case *set:
+			if len(args) != 2 {
+				return cmd.UsageError("--set takes a key and a value")
+			}
+			if _, err := svcs.NormalizeValue(args[1], *valueType); err != nil {
+				return err
+			}
+			return config.Set(scope, args[0], args[1])
+		case *unset:
+			if len(args) != 1 {
+				return cmd.UsageError("--unset takes exactly one key")
+			}
+			return config.Unset(scope, args[0])
+		case *list:
+			pairs := config.List()
+			if scoped {
+				pairs = config.Files[scope].List()
+			}
+			if outputFormat == FormatJSON {
+				values := map[string]string{}
+				for _, pair := range pairs {
+					key, value, _ := strings.Cut(pair, "=")
+					values[key] = value
+				}
+				return printJSON(struct {
+					Values map[string]string `json:"values"`
+				}{values})
+			}
+			for _, pair := range pairs {
+				fmt.Println(pair)
+			}
+		default:
+			// The username shortcut predates scoped configuration
+			if len(args) == 2 {
+				return cmd.UsageError("too many arguments")
+			}
+			if len(args) == 1 {
+				if err := config.Set(scope, "user.name", args[0]); err != nil {
+					return err
+				}
+			}
+			name := config.GetString("user.name")
+			if outputFormat != FormatText {
+				return printConfigValue("user.name", name)
+			}
+			if name == "" {
+				fmt.Println("Please, tell me who you are.")
+				return nil
+			}
+			fmt.Printf("The username is %s.\n", name)
+		}
+		return nil
+	}
+	return cmd
+}
+
+func printConfigValue(key, value string) error {
+	if outputFormat == FormatJSON {
+		return printJSON(struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		}{key, value})
+	}
+	fmt.Println(value)
+	return nil
+}
+
+func newAddCommand() *Command {
+	return withFormats(&Command{
+		Name:    "add",
+		Summary: "Add a file to the index.",
+		Usage:   "[<file>...]",
+		Help:    "Without arguments, lists the tracked files.",
+		MaxArgs: -1,
+		Run: func(args []string) error {
+			if err := repo.Add(args...); err != nil {
+				return err
+			}
+			if outputFormat == FormatText {
+				for _, fn := range args {
+					fmt.Printf("The file '%s' is tracked.\n", fn)
+				}
+				if len(args) > 0 {
+					return nil
+				}
+			}
+			tracked := repo.Tracked()
+			switch outputFormat {
+			case FormatJSON:
+				if tracked == nil {
+					tracked = []string{}
+				}
+				return printJSON(struct {
+					Files []string `json:"files"`
+				}{tracked})
+			case FormatPorcelain:
+				for _, fn := range tracked {
+					fmt.Println(fn)
+				}
+				return nil
+			}
+			if len(tracked) == 0 {
+				fmt.Println("Add a file to the index.")
+				return nil
+			}
+			fmt.Println("Tracked files:")
+			for _, fn := range tracked {
+				fmt.Printf("%s\n", fn)
+			}
+			return nil
+		},
+	})
+}
+
+func newLogCommand() *Command {
+	cmd := withFormats(&Command{
+		Name:    "log",
+		Summary: "Show commit logs.",
+		Usage: "[-n <number>] [--since=<date>] [--until=<date>] [--author=<pattern>] [--grep=<pattern>]\n" +
+			"                [--oneline | --pretty=format:<template>] [--graph] [--decorate] [--all] [--] [<path>...]",
+		Help: "Lists the commits of the current branch, or of every branch and tag with --all, each\n" +
+			"before its parents and otherwise newest first. With paths, only the commits that changed\n" +
+			"a file at or under one of them are listed. --graph draws the history as ASCII lanes,\n" +
+			"with branch and tag names next to the commits they point to, as with --decorate.\n" +
+			"Dates are YYYY-MM-DD, RFC 3339 or how long ago, such as '2w' or '3d'. Patterns are\n" +
+			"regular expressions; --author matches 'name <email>'.\n" +
+			"A --pretty template may use %H (hash), %h (short hash), %an (author name), %ae (author\n" +
+			"email), %ad (author date), %s (subject), %d (branch and tag names), %n (newline) and %%.",
+		MaxArgs: -1,
+	})
+	flags := cmd.Flags()
+	limit := flags.Int("n", 0, "show at most `number` commits")
+	since := flags.String("since", "", "show commits more recent than `date`")
+	until := flags.String("until", "", "show commits older than `date`")
+	author := flags.String("author", "", "show commits whose author matches `pattern`")
+	grep := flags.String("grep", "", "show commits whose message matches `pattern`")
+	oneline := flags.Bool("oneline", false, "show each commit as its short hash and subject")
+	pretty := flags.String("pretty", "", "show each commit as `format:<template>`")
+	drawGraph := flags.Bool("graph", false, "draw the history as a graph")
+	decorate := flags.Bool("decorate", false, "show the branches and tags pointing to each commit")
+	all := flags.Bool("all", false, "show the history of every branch and tag")
+	cmd.Run = func(args []string) error {
+		opts := svcs.LogOptions{Max: *limit, Paths: args, All: *all}
+		if *limit < 0 {
+			return cmd.UsageError("-n must not be negative")
+		}
+		var err error
+		now := time.Now()
+		for _, date := range []struct {
+			value string
+			to    *time.Time
+		}{{*since, &opts.Since}, {*until, &opts.Until}} {
+			if date.value == "" {
+				continue
+			}
+			if *date.to, err = svcs.ParseDate(date.value, now); err != nil {
+				return cmd.UsageError(err.Error())
+			}
+		}
+		for _, pattern := range []struct {
+			value string
+			to    **regexp.Regexp
+		}{{*author, &opts.Author}, {*grep, &opts.Grep}} {
+			if pattern.value == "" {
+				continue
+			}
+			if *pattern.to, err = regexp.Compile(pattern.value); err != nil {
+				return cmd.UsageError(fmt.Sprintf("bad pattern '%s'", pattern.value))
+			}
+		}
+		template := ""
+		switch {
+		case *oneline && *pretty != "":
+			return cmd.UsageError("--oneline and --pretty are exclusive")
+		case *oneline && (*drawGraph || *decorate):
+			template = "%h%d %s"
+		case *oneline:
+			template = "%h %s"
+		case *pretty != "":
+			var ok bool
+			if template, ok = strings.CutPrefix(*pretty, "format:"); !ok {
+				return cmd.UsageError(fmt.Sprintf("unknown pretty format '%s', expected format:<template>", *pretty))
+			}
+		}
+		if (template != "" || *drawGraph || *decorate) && outputFormat != FormatText {
+			return cmd.UsageError("--oneline, --pretty, --graph and --decorate only apply to text output")
+		}
+
+		commits, err := repo.Log(opts)
+		if err != nil {
+			return err
+		}
+		switch outputFormat {
+		case FormatJSON:
+			if commits == nil {
+				commits = []svcs.Commit{}
+			}
+			return printJSON(struct {
+				Commits []svcs.Commit `json:"commits"`
+			}{commits})
+		case FormatPorcelain:
+			for _, commit := range commits {
+				fmt.Printf("%s\t%s\t%s\t%s\n", commit.Hash, commit.Author, commit.Email, commit.Subject())
+			}
+			return nil
+		}
+		if len(commits) == 0 {
+			if head, err := repo.Head(); err != nil || head != nil {
+				return err
+			}
+			fmt.Println("No commits yet.")
+			return nil
+		}
+		decorations := map[string]string{}
+		if *drawGraph || *decorate || strings.Contains(template, "%d") {
+			if decorations, err = refDecorations(); err != nil {
+				return err
+			}
+		}
+		var g graph
+		shown := map[string]bool{}
+		for _, commit := range commits {
+			shown[commit.Hash] = true
+		}
+		known := map[string][]string{}
+		for _, commit := range commits {
+			var text []string
+			if template != "" {
+				text = strings.Split(formatCommit(template, &commit, decorations[commit.Hash]), "\n")
+			} else {
+				text = append(text, "commit "+commit.Hash+decorations[commit.Hash])
+				if commit.Email != "" {
+					text = append(text, fmt.Sprintf("Author: %s <%s>", commit.Author, commit.Email))
+				} else {
+					text = append(text, "Author: "+commit.Author)
+				}
+				text = append(text, strings.Split(commit.Message, "\n")...)
+				text = append(text, "")
+			}
+			if *drawGraph {
+				parents, err := shownParents(&commit, shown, known)
+				if err != nil {
+					return err
+				}
+				text = g.draw(commit.Hash, parents, text)
+			}
+			for _, line := range text {
+				fmt.Println(line)
+			}
+		}
+		return nil
+	}
+	return cmd
+}
+
+// refDecorations returns the names of the branches and tags pointing to each
+// commit, as " (HEAD -> main, tag: v1)", by commit id.
+func refDecorations() (map[string]string, error) {
+	refs, err := repo.Refs()
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	names := map[string][]string{}
+	if head != nil && repo.Branch() == "" {
+		names[head.Hash] = []string{svcs.Head}
+	}
+	for _, ref := range refs {
+		name := strings.TrimPrefix(ref.Name, "refs/")
+		if branch, ok := strings.CutPrefix(ref.Name, "refs/heads/"); ok && branch == repo.Branch() {
+			names[ref.Commit] = append([]string{svcs.Head + " -> " + branch}, names[ref.Commit]...)
+			continue
+		} else if ok {
+			name = branch
+		} else if tag, ok := strings.CutPrefix(ref.Name, "refs/tags/"); ok {
+			name = "tag: " + tag
+		}
+		names[ref.Commit] = append(names[ref.Commit], name)
+	}
+	decorations := map[string]string{}
+	for id, list := range names {
+		decorations[id] = " (" + strings.Join(list, ", ") + ")"
+	}
+	return decorations, nil
+}
+
+func newReflogCommand() *Command {
+	return withFormats(&Command{
+		Name:    "reflog",
+		Summary: "Show where HEAD and branches have been.",
+		Usage:   "[<ref>]",
+		Help: "Lists every commit that HEAD, or the given branch, has pointed to, newest first, with the\n" +
+			"command that moved it. <ref>@{<n>} names the nth entry as a revision, e.g. HEAD@{1}.",
+		MaxArgs: 1,
+		Run: func(args []string) error {
+			ref := svcs.Head
+			if len(args) == 1 {
+				ref = args[0]
+			}
+			entries, err := repo.Reflog(ref)
+			if err != nil {
+				return err
+			}
+			switch outputFormat {
+			case FormatJSON:
+				return printJSON(struct {
+					Entries []svcs.ReflogEntry `json:"entries"`
+				}{entries})
+			case FormatPorcelain:
+				for _, entry := range entries {
+					fmt.Printf("%s\t%s\t%s\t%s\t%s\t%s\n", entry.New, entry.Old, entry.Actor, entry.Email,
+						entry.Date.Format(time.RFC3339), entry.Command)
+				}
+				return nil
+			}
+			for i, entry := range entries {
+				fmt.Printf("%s %s@{%d}: %s\n", entry.New, ref, i, entry.Command)
+			}
+			return nil
+		},
+	})
+}
+
+func newShowCommand() *Command {
+	cmd := withFormats(&Command{
+		Name:    "show",
+		Summary: "Show a commit or a file as of a commit.",
+		Usage:   "[<commit> | <commit>:<path>]",
+		Help: "Shows the given commit, by default the latest one: its metadata, the files it added,\n" +
+			"modified or deleted relative to its parent, and their diff.\n" +
+			"<commit>:<path> prints the contents of one file as of that commit instead.",
+		MaxArgs: 1,
+	})
+	cmd.Run = func(args []string) error {
+		rev := svcs.Head
+		if len(args) == 1 {
+			rev = args[0]
+		}
+		if rev, name, ok := strings.Cut(rev, ":"); ok {
+			if outputFormat != FormatText {
+				return cmd.UsageError("<commit>:<path> only prints the file contents")
+			}
+			file, err := repo.OpenFileAt(rev, name)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			_, err = io.Copy(os.Stdout, file)
+			return err
+		}
+		commit, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return err
+		}
+		diffs, err := repo.Changes(commit)
+		if err != nil {
+			return err
+		}
+		switch outputFormat {
+		case FormatJSON:
+			if diffs == nil {
+				diffs = []svcs.FileDiff{}
+			}
+			return printJSON(struct {
+				Commit *svcs.Commit    `json:"commit"`
+				Files  []svcs.FileDiff `json:"files"`
+			}{commit, diffs})
+		case FormatPorcelain:
+			for _, diff := range diffs {
+				fmt.Printf("%s %s\n", porcelainCodes[diff.State], diff.Path)
+			}
+			return nil
+		}
+		printCommit(commit)
+		if len(diffs) == 0 {
+			return nil
+		}
+		fmt.Println("")
+		for _, diff := range diffs {
+			fmt.Printf("%-11s %s\n", diff.State+":", diff.Path)
+		}
+		fmt.Println("")
+		for _, diff := range diffs {
+			fmt.Print(diff.Patch)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// printCommit prints the metadata and message of commit.
+func printCommit(commit *svcs.Commit) {
+	fmt.Println("commit " + commit.Hash)
+	for _, parent := range commit.Parents {
+		fmt.Println("Parent: " + parent)
+	}
+	if commit.Email != "" {
+		fmt.Printf("Author: %s <%s>\n", commit.Author, commit.Email)
+	} else {
+		fmt.Println("Author: " + commit.Author)
+	}
+	fmt.Println("Date:   " + commit.Date.Format(dateFormat))
+	fmt.Println("")
+	fmt.Println(commit.Message)
+}
+
+func newBlameCommand() *Command {
+	cmd := withFormats(&Command{
+		Name:    "blame",
+		Summary: "Show the commit that last changed each line of a file.",
+		Usage:   "[-L <start>,<end>] [--json] [<commit>] [--] <path>",
+		Help: "Prints each line of the file as of the given commit, by default the latest one, with the\n" +
+			"short id, author and date of the commit that last changed it, found by comparing each\n" +
+			"commit with its parents. -L limits the output to lines <start> to <end>, or to <count>\n" +
+			"lines with <start>,+<count>.",
+		MinArgs: 1,
+		MaxArgs: 2,
+	})
+	lineRange := cmd.Flags().String("L", "", "only show the lines `start,end`")
+	cmd.Flags().Var(jsonFlag{}, "json", "same as --format=json")
+	cmd.Run = func(args []string) error {
+		rev, name := svcs.Head, args[0]
+		if len(args) == 2 {
+			rev, name = args[0], args[1]
+		}
+		lines, err := repo.Blame(rev, name)
+		if err != nil {
+			return err
+		}
+		if *lineRange != "" {
+			start, end, err := parseLineRange(*lineRange, len(lines))
+			if err != nil {
+				return cmd.UsageError(err.Error())
+			}
+			lines = lines[start-1 : end]
+		}
+		switch outputFormat {
+		case FormatJSON:
+			return printJSON(struct {
+				Path  string           `json:"path"`
+				Lines []svcs.BlameLine `json:"lines"`
+			}{name, lines})
+		case FormatPorcelain:
+			for _, line := range lines {
+				fmt.Printf("%s\t%d\t%s\t%s\t%s\t%s\n", line.Commit, line.Line, line.Author, line.Email,
+					line.Date.Format(time.RFC3339), line.Text)
+			}
+			return nil
+		}
+		authorWidth, lineWidth := 0, len(strconv.Itoa(len(lines)))
+		for _, line := range lines {
+			authorWidth = max(authorWidth, len(line.Author))
+			lineWidth = max(lineWidth, len(strconv.Itoa(line.Line)))
+		}
+		for _, line := range lines {
+			fmt.Printf("%s (%-*s %s %*d) %s\n", line.Commit[:shortHashLength], authorWidth, line.Author,
+				line.Date.Format(time.DateOnly), lineWidth, line.Line, line.Text)
+		}
+		return nil
+	}
+	return cmd
+}
+
+// parseLineRange parses the -L range "<start>,<end>" or "<start>,+<count>" of
+// a file of total lines. An end past the last line stops at it.
+func parseLineRange(value string, total int) (int, int, error) {
+	bad := fmt.Errorf("bad line range '%s', expected <start>,<end> or <start>,+<count>", value)
+	first, last, ok := strings.Cut(value, ",")
+	start, err := strconv.Atoi(first)
+	if !ok || err != nil || start < 1 {
+		return 0, 0, bad
+	}
+	var end int
+	if count, ok := strings.CutPrefix(last, "+"); ok {
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return 0, 0, bad
+		}
+		end = start + n - 1
+	} else if end, err = strconv.Atoi(last); err != nil || end < start {
+		return 0, 0, bad
+	}
+	if start > total {
+		return 0, 0, fmt.Errorf("the file only has %d lines", total)
+	}
+	return start, min(end, total), nil
+}
+
+func newBisectCommand() *Command {
+	cmd := &Command{
+		Name:    "bisect",
+		Summary: "Find the commit that introduced a bug by binary search.",
+		Usage: "start [<bad> [<good>...]] | good [<commit>...] | bad [<commit>] | skip [<commit>...] |\n" +
+			"                   reset | run <command> [<argument>...]",
+		Help: "Checks out the commit halfway between the known good and bad ones until the first bad\n" +
+			"one is found. Mark each commit as good or bad, or skip it if it can't be tested; the\n" +
+			"commit defaults to the current one. reset returns to the branch or commit that was\n" +
+			"current before start.\n" +
+			"run marks every commit by running the command in the work tree: exit status 0 means\n" +
+			"good, 125 means skip, 1 to 127 mean bad, and anything else stops the search.",
+		MinArgs: 1,
+		MaxArgs: -1,
+		NoFlags: true,
+	}
+	cmd.Run = func(args []string) error {
+		sub, args := args[0], args[1:]
+		var result *svcs.BisectResult
+		var err error
+		switch sub {
+		case "start":
+			bad, good := "", []string(nil)
+			if len(args) > 0 {
+				bad, good = args[0], args[1:]
+			}
+			result, err = repo.BisectStart(bad, good)
+		case svcs.BisectGood, svcs.BisectSkip:
+			if len(args) == 0 {
+				args = []string{svcs.Head}
+			}
+			for _, rev := range args {
+				if result, err = repo.BisectMark(sub, rev); err != nil {
+					break
+				}
+			}
+		case svcs.BisectBad:
+			if len(args) > 1 {
+				return cmd.UsageError("only one commit can be bad")
+			}
+			rev := svcs.Head
+			if len(args) == 1 {
+				rev = args[0]
+			}
+			result, err = repo.BisectMark(sub, rev)
+		case "reset":
+			if len(args) > 0 {
+				return cmd.UsageError("wrong number of arguments")
+			}
+			commit, err := repo.BisectReset()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Switched to commit %s.\n", commit.Hash)
+			return nil
+		case "run":
+			if len(args) == 0 {
+				return cmd.UsageError("command was not passed")
+			}
+			return bisectRun(args)
+		default:
+			return cmd.UsageError(fmt.Sprintf("unknown subcommand '%s'", sub))
+		}
+		if err != nil {
+			return err
+		}
+		printBisectResult(result)
+		return nil
+	}
+	return cmd
+}
+
+// bisectRun marks commits by the exit status of the command args until the
+// first bad commit is found.
+func bisectRun(args []string) error {
+	for {
+		fmt.Println("running " + strings.Join(args, " "))
+		run := exec.Command(args[0], args[1:]...)
+		run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+		code := 0
+		var exitErr *exec.ExitError
+		if err := run.Run(); errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			return fmt.Errorf("bisect run: %w", err)
+		}
+		var term string
+		switch {
+		case code == 0:
+			term = svcs.BisectGood
+		case code == 125:
+			term = svcs.BisectSkip
+		case code > 0 && code < 128:
+			term = svcs.BisectBad
+		default:
+			return fmt.Errorf("bisect run: '%s' exited with status %d, stopping", args[0], code)
+		}
+		result, err := repo.BisectMark(term, svcs.Head)
+		if err != nil {
+			return err
+		}
+		printBisectResult(result)
+		if result.Next == nil {
+			if result.Found == nil && len(result.Skipped) == 0 {
+				return errors.New("bisect run needs a good and a bad commit to start from")
+			}
+			return nil
+		}
+	}
+}
+
+// plural returns noun, in the plural unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+func printBisectResult(result *svcs.BisectResult) {
+	switch {
+	case result.Next != nil:
+		steps := bits.Len(uint(result.Left))
+		fmt.Printf("Bisecting: %d %s left to test after this (roughly %d %s)\n",
+			result.Left, plural(result.Left, "revision"), steps, plural(steps, "step"))
+		fmt.Printf("[%s] %s\n", result.Next.Hash, result.Next.Subject())
+	case result.Found != nil:
+		fmt.Printf("%s is the first bad commit\n", result.Found.Hash)
+		printCommit(result.Found)
+	case len(result.Skipped) > 0:
+		fmt.Println("There are only skipped commits left to test.")
+		fmt.Println("The first bad commit could be any of:")
+		for _, id := range result.Skipped {
+			fmt.Println(id)
+		}
+	default:
+		fmt.Println("Waiting for both good and bad commits.")
+	}
+}
+
+func newCommitCommand() *Command {
+	cmd := withFormats(&Command{
+		Name:    "commit",
+		Summary: "Save changes.",
+		Usage:   "[-a] [--amend] [-m <message>]... [-F <file>] [<message>]",
+		Help: "Records the staged files as a new commit. The message is given with -m, each one a\n" +
+			"paragraph, as an argument, or read from a file with -F (- for standard input). Otherwise\n" +
+			"core.editor, $VISUAL or $EDITOR edits it, starting from a template that lists the staged\n" +
+			"files; lines starting with # are left out. --amend replaces the last commit with one\n" +
+			"that also has the staged changes, keeping its message unless a new one is given. -a\n" +
+			"first stages the changes to tracked files, deletions included, but no untracked files.\n" +
+			"The pre-commit and commit-msg hooks in vcs/hooks can reject the commit, and the latter\n" +
+			"rewrite the message; post-commit is then told the new commit id.",
+		MaxArgs: 1,
+	})
+	var paragraphs paragraphsFlag
+	cmd.Flags().Var(&paragraphs, "m", "use the given `message` as a paragraph, may be repeated")
+	file := cmd.Flags().String("F", "", "read the message from `file`, - for standard input")
+	amend := cmd.Flags().Bool("amend", false, "replace the last commit")
+	all := cmd.Flags().Bool("a", false, "stage the changes to tracked files first")
+	cmd.Run = func(args []string) error {
+		paragraphs = append(paragraphs, args...)
+		if len(paragraphs) > 0 && *file != "" {
+			return cmd.UsageError("-F can't be used with -m or a message argument")
+		}
+		var changed []svcs.FileStatus
+		restore := func() error { return nil }
+		if *all {
+			var err error
+			if changed, restore, err = repo.StageTracked(); err != nil {
+				return err
+			}
+		}
+		// An aborted commit leaves the index as it found it
+		commit, err := commitStaged(cmd, paragraphs, *file, *amend)
+		if err != nil {
+			if restoreErr := restore(); restoreErr != nil {
+				return errors.Join(err, restoreErr)
+			}
+			return err
+		}
+		if outputFormat == FormatText {
+			for _, status := range changed {
+				fmt.Printf("Staged %s: %s\n", status.Unstaged, status.Path)
+			}
+		}
+		notifyHook(hookPostCommit, commit.Hash)
+		switch outputFormat {
+		case FormatJSON:
+			return printJSON(commit)
+		case FormatPorcelain:
+			fmt.Println(commit.Hash)
+			return nil
+		}
+		fmt.Println("Changes are committed.")
+		return nil
+	}
+	return cmd
+}
+
+// commitStaged runs the pre-commit hook, takes the message from paragraphs,
+// file, the amended commit or the editor, has the commit-msg hook check it,
+// and commits the index, or amends the last commit with it.
+func commitStaged(cmd *Command, paragraphs paragraphsFlag, file string, amend bool) (*svcs.Commit, error) {
+	if err := runHook(hookPreCommit); err != nil {
+		return nil, err
+	}
+	var message string
+	var err error
+	switch {
+	case len(paragraphs) > 0:
+		message = cleanMessage(paragraphs.String(), false)
+	case file != "":
+		message, err = readMessage(file)
+	case amend:
+		// The message of the amended commit stays, as the commit-msg hook leaves it
+		var head *svcs.Commit
+		if head, err = repo.Head(); err == nil && head != nil {
+			message = head.Message
+		}
+	default:
+		editor := messageEditor()
+		if editor == "" {
+			return nil, cmd.UsageError("message was not passed, and no editor is set in core.editor or $EDITOR")
+		}
+		message, err = editMessage(editor)
+	}
+	if err == nil && message != "" {
+		message, err = checkMessage(message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if message == "" && !amend {
+		return nil, errEmptyMessage
+	}
+	save := repo.Commit
+	if amend {
+		save = repo.Amend
+	}
+	return save(message)
+}
+
+func newCheckoutCommand() *Command {
+	cmd := &Command{
+		Name:    "checkout",
+		Summary: "Restore a file.",
+		Usage:   "<commit>",
+		Help: "Overwrites the files of the given commit with their contents as of it and tracks them.\n" +
+			"Checking out a branch makes further commits advance it. The post-checkout hook in\n" +
+			"vcs/hooks is then told the previous and the new commit id.",
+		MaxArgs: 1,
+	}
+	cmd.Run = func(args []string) error {
+		if len(args) == 0 {
+			return cmd.UsageError("commit id was not passed")
+		}
+		previous, err := repo.Head()
+		if err != nil {
+			return err
+		}
+		commit, err := repo.Checkout(args[0])
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			notifyHook(hookPostCheckout, previous.Hash, commit.Hash, "1")
+		}
+		fmt.Printf("Switched to commit %s.\n", commit.Hash)
+		return nil
+	}
+	return cmd
+}
+
+func newCherryPickCommand() *Command {
+	cmd := &Command{
+		Name:    "cherry-pick",
+		Summary: "Apply the changes of existing commits.",
+		Usage: "<commit>...\n" +
+			"                        --continue | --abort",
+		Help: "Applies the changes that each commit made to its parent on top of the current commit with\n" +
+			"a three-way merge, and commits them with the original author, date and message. The\n" +
+			"index and the tracked files must not have changes. If the changes conflict, the files\n" +
+			"get conflict markers: resolve them, stage the files and use --continue, or --abort to\n" +
+			"return to where the cherry-pick started.",
+		MaxArgs: -1,
+	}
+	resume := cmd.Flags().Bool("continue", false, "commit the resolved conflicts and go on")
+	abort := cmd.Flags().Bool("abort", false, "give up and return to the original commit")
+	cmd.Run = func(args []string) error {
+		var result *svcs.CherryPickResult
+		var err error
+		switch {
+		case *resume && *abort:
+			return cmd.UsageError("--continue and --abort can't be used together")
+		case (*resume || *abort) && len(args) > 0:
+			return cmd.UsageError("--continue and --abort take no commits")
+		case *abort:
+			commit, err := repo.CherryPickAbort()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Switched to commit %s.\n", commit.Hash)
+			return nil
+		case *resume:
+			result, err = repo.CherryPickContinue()
+		case len(args) == 0:
+			return cmd.UsageError("commit id was not passed")
+		default:
+			result, err = repo.CherryPick(args)
+		}
+		if err != nil {
+			return err
+		}
+		return printPicks(result, "svcs cherry-pick")
+	}
+	return cmd
+}
+
+func newRebaseCommand() *Command {
+	cmd := &Command{
+		Name:    "rebase",
+		Summary: "Replay commits on top of another one.",
+		Usage: "<upstream> | --plan <file> [<upstream>]\n" +
+			"                   --continue | --skip | --abort",
+		Help: "Replays the commits of the current branch that <upstream> does not have on top of it,\n" +
+			"oldest first, as cherry-pick does, and then moves the branch to them. With --plan,\n" +
+			"replays the steps of the file instead, one \"<action> <commit>\" per line, where the\n" +
+			"action is pick, reword (followed by the new message), squash, fixup or drop; without\n" +
+			"<upstream>, they go on top of the parent of the first commit. If the changes of a step\n" +
+			"conflict, resolve and stage the files and use --continue, --skip to leave the commit\n" +
+			"out, or --abort.",
+		MaxArgs: 1,
+	}
+	plan := cmd.Flags().String("plan", "", "carry out the steps of the plan `file`")
+	resume := cmd.Flags().Bool("continue", false, "commit the resolved conflicts and go on")
+	skip := cmd.Flags().Bool("skip", false, "leave out the commit that conflicts and go on")
+	abort := cmd.Flags().Bool("abort", false, "give up and return to the original commit")
+	cmd.Run = func(args []string) error {
+		resuming := 0
+		for _, set := range []bool{*resume, *skip, *abort} {
+			if set {
+				resuming++
+			}
+		}
+		if resuming > 1 {
+			return cmd.UsageError("only one of --continue, --skip and --abort can be used")
+		}
+		if resuming == 1 && (len(args) > 0 || *plan != "") {
+			return cmd.UsageError("--continue, --skip and --abort take no other arguments")
+		}
+		var result *svcs.RebaseResult
+		var err error
+		switch {
+		case *abort:
+			commit, err := repo.RebaseAbort()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Switched to commit %s.\n", commit.Hash)
+			return nil
+		case *resume:
+			result, err = repo.RebaseContinue()
+		case *skip:
+			result, err = repo.RebaseSkip()
+		case *plan != "":
+			var steps []svcs.RebaseStep
+			if steps, err = readPlan(*plan); err != nil {
+				return err
+			}
+			upstream := ""
+			if len(args) == 1 {
+				upstream = args[0]
+			}
+			result, err = repo.Rebase(upstream, steps)
+		case len(args) == 0:
+			return cmd.UsageError("upstream was not passed")
+		default:
+			result, err = repo.Rebase(args[0], nil)
+		}
+		if err != nil {
+			return err
+		}
+		if result.UpToDate {
+			fmt.Println("Current branch is up to date.")
+			return nil
+		}
+		if err = printPicks(&result.CherryPickResult, "svcs rebase"); err != nil {
+			return err
+		}
+		fmt.Printf("Successfully rebased onto %s.\n", result.Onto.Hash)
+		return nil
+	}
+	return cmd
+}
+
+// readPlan reads the rebase plan in the file name.
+func readPlan(name string) ([]svcs.RebaseStep, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := svcs.ParseRebasePlan(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return steps, nil
+}
+
+// printPicks prints the commits made by a cherry-pick and fails if it stopped
+// on conflicts, telling how to resume it with the command name.
+func printPicks(result *svcs.CherryPickResult, name string) error {
+	for _, commit := range result.Empty {
+		fmt.Printf("Skipped %s, its changes are already there.\n", commit.Hash)
+	}
+	for _, commit := range result.Commits {
+		fmt.Printf("[%s] %s\n", commit.Hash, commit.Subject())
+	}
+	if result.Stopped == nil {
+		return nil
+	}
+	fmt.Printf("Could not apply %s %s\n", result.Stopped.Hash, result.Stopped.Subject())
+	for _, path := range result.Conflicts {
+		fmt.Println("conflict: " + path)
+	}
+	return svcs.NewError(svcs.ErrConflict, "resolve the conflicts, stage the files and run '%s --continue', or '%s --abort'", name, name)
+}
+
+func newStatusCommand() *Command {
+	return withFormats(&Command{
+		Name:    "status",
+		Summary: "Show the working tree status.",
+		Help: "Lists the changes staged for the next commit, the changes to tracked files that are\n" +
+			"not staged yet, and untracked files.",
+		Run: func(args []string) error {
+			statuses, err := repo.Status()
+			if err != nil {
+				return err
+			}
+			switch outputFormat {
+			case FormatJSON:
+				if statuses == nil {
+					statuses = []svcs.FileStatus{}
+				}
+				return printJSON(struct {
+					Files []svcs.FileStatus `json:"files"`
+				}{statuses})
+			case FormatPorcelain:
+				for _, status := range statuses {
+					if status.Staged != svcs.StateUnmodified || status.Unstaged != svcs.StateUnmodified {
+						fmt.Printf("%s%s %s\n", porcelainCodes[status.Staged], porcelainCodes[status.Unstaged], status.Path)
+					}
+				}
+				return nil
+			}
+			var staged, unstaged, untracked []string
+			for _, status := range statuses {
+				if status.Staged == svcs.StateUntracked {
+					untracked = append(untracked, status.Path)
+					continue
+				}
+				if status.Staged != svcs.StateUnmodified {
+					staged = append(staged, fmt.Sprintf("%-11s %s", status.Staged+":", status.Path))
+				}
+				switch status.Unstaged {
+				case svcs.StateUnmodified:
+				case svcs.StateUntracked:
+					untracked = append(untracked, status.Path)
+				default:
+					unstaged = append(unstaged, fmt.Sprintf("%-11s %s", status.Unstaged+":", status.Path))
+				}
+			}
+			if len(staged) == 0 && len(unstaged) == 0 && len(untracked) == 0 {
+				fmt.Println("Nothing to commit, working tree clean.")
+				return nil
+			}
+			for _, section := range []struct {
+				title string
+				lines []string
+			}{
+				{"Changes to be committed:", staged},
+				{"Changes not staged for commit:", unstaged},
+				{"Untracked files:", untracked},
+			} {
+				if len(section.lines) > 0 {
+					fmt.Println(section.title)
+					for _, line := range section.lines {
+						fmt.Println("  " + line)
+					}
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func newDiffCommand() *Command {
+	return &Command{
+		Name:    "diff",
+		Summary: "Show changes to tracked files.",
+		Usage:   "[<commit>]",
+		Help:    "Compares the tracked files with their contents as of the given commit, by default the latest one.",
+		MaxArgs: 1,
+		Run: func(args []string) error {
+			rev := ""
+			if len(args) == 1 {
+				rev = args[0]
+			}
+			diffs, err := repo.Diff(rev)
+			if err != nil {
+				return err
+			}
+			for _, diff := range diffs {
+				fmt.Print(diff.Patch)
+			}
+			return nil
+		},
+	}
+}
+
+func newFsckCommand() *Command {
+	return withFormats(&Command{
+		Name:    "fsck",
+		Summary: "Verify the integrity of the repository.",
+		Help: "Re-hashes every stored object and large file and checks that everything commits,\n" +
+			"trees, branches, the reflogs and the index refer to exists. Objects that nothing leads\n" +
+			"to are listed as dangling. Exits with status 9 if there are problems.",
+		NoRepository: true,
+		Run: func(args []string) error {
+			result, err := svcs.Fsck(".")
+			if err != nil {
+				return err
+			}
+			switch outputFormat {
+			case FormatJSON:
+				if err = printJSON(result); err != nil {
+					return err
+				}
+			case FormatPorcelain:
+				for _, problem := range result.Problems {
+					fmt.Printf("error %s\n", problem)
+				}
+				for _, object := range result.Dangling {
+					fmt.Printf("dangling %s %s\n", object.Type, object.ID)
+				}
+			default:
+				for _, problem := range result.Problems {
+					fmt.Printf("error: %s\n", problem)
+				}
+				for _, object := range result.Dangling {
+					fmt.Printf("dangling %s %s\n", object.Type, object.ID)
+				}
+				if result.Large > 0 {
+					fmt.Printf("Checked %d objects and %d large files.\n", result.Objects, result.Large)
+				} else {
+					fmt.Printf("Checked %d objects.\n", result.Objects)
+				}
+			}
+			if len(result.Problems) > 0 {
+				return svcs.NewError(svcs.ErrCorrupt, "found %d problem(s)", len(result.Problems))
+			}
+			return nil
+		},
+	})
+}
+
+func newGCCommand() *Command {
+	cmd := withFormats(&Command{
+		Name:    "gc",
+		Summary: "Remove unreachable objects and pack the others.",
+		Usage:   "[--prune=<expiry>]",
+		Help: "Removes the objects and large files that HEAD, the refs, their reflogs and the index do\n" +
+			"not lead to once they are older than the grace period, and packs the small objects that\n" +
+			"remain into a single pack. Large files are never packed.\n" +
+			"The grace period is two weeks unless --prune or gc.pruneExpire gives one: 'now', 'never'\n" +
+			"or a duration such as '2w', '3d' or '12h'.",
+	})
+	prune := cmd.Flags().String("prune", "", "remove unreachable objects older than `expiry`")
+	cmd.Run = func(args []string) error {
+		expire := svcs.DefaultExpire
+		var err error
+		if *prune != "" {
+			if expire, err = svcs.ParseExpire(*prune); err != nil {
+				return cmd.UsageError(err.Error())
+			}
+		} else if value := repo.Config.GetString("gc.pruneExpire"); value != "" {
+			if expire, err = svcs.ParseExpire(value); err != nil {
+				return fmt.Errorf("gc.pruneExpire: %w", err)
+			}
+		}
+		result, err := repo.GC(svcs.GCOptions{Expire: expire})
+		if err != nil {
+			return err
+		}
+		switch outputFormat {
+		case FormatJSON:
+			return printJSON(result)
+		case FormatPorcelain:
+			fmt.Printf("packed %d\nloose %d\npruned %d\nkept %d\n", result.Packed, result.Loose, result.Pruned, result.Kept)
+			fmt.Printf("pruned-large %d\nkept-large %d\n", result.PrunedLarge, result.KeptLarge)
+			return nil
+		}
+		if result.Packed > 0 {
+			fmt.Printf("Packed %d objects into %s.\n", result.Packed, result.Pack)
+		}
+		if result.Loose > 0 {
+			fmt.Printf("Left %d large objects loose.\n", result.Loose)
+		}
+		fmt.Printf("Removed %d unreachable objects.\n", result.Pruned)
+		if result.Kept > 0 {
+			fmt.Printf("Kept %d unreachable objects until they expire.\n", result.Kept)
+		}
+		if result.PrunedLarge > 0 {
+			fmt.Printf("Removed %d unreachable large files.\n", result.PrunedLarge)
+		}
+		if result.KeptLarge > 0 {
+			fmt.Printf("Kept %d unreachable large files until they expire.\n", result.KeptLarge)
+		}
+		return nil
+	}
+	return cmd
+}
+
+func newCountObjectsCommand() *Command {
+	return withFormats(&Command{
+		Name:    "count-objects",
+		Summary: "Show how much space the objects use.",
+		Help: "Counts the loose and packed objects and the disk space they use, compared with\n" +
+			"the size of their contents: objects are compressed, and packed ones may be deltas.",
+		Run: func(args []string) error {
+			counts, err := repo.CountObjects()
+			if err != nil {
+				return err
+			}
+			switch outputFormat {
+			case FormatJSON:
+				return printJSON(counts)
+			case FormatPorcelain:
+				fmt.Printf("count %d\nsize %d\nin-pack %d\npacks %d\ndeltas %d\nsize-pack %d\nsize-content %d\n",
+					counts.Loose, counts.LooseSize, counts.Packed, counts.Packs, counts.Deltas, counts.PackSize, counts.Size)
+				return nil
+			}
+			fmt.Printf("Loose objects: %d, %s on disk\n", counts.Loose, formatSize(counts.LooseSize))
+			fmt.Printf("Packed objects: %d in %d packs, %d of them deltas, %s on disk\n",
+				counts.Packed, counts.Packs, counts.Deltas, formatSize(counts.PackSize))
+			disk := counts.LooseSize + counts.PackSize
+			if counts.Size == 0 {
+				return nil
+			}
+			if saved := 100 - disk*100/counts.Size; saved >= 0 {
+				fmt.Printf("Contents: %s stored in %s, %d%% saved\n", formatSize(counts.Size), formatSize(disk), saved)
+			} else {
+				fmt.Printf("Contents: %s stored in %s, %d%% more\n", formatSize(counts.Size), formatSize(disk), -saved)
+			}
+			return nil
+		},
+	})
+}
+
+func newUpgradeCommand() *Command {
+	return withFormats(&Command{
+		Name:    "upgrade",
+		Summary: "Convert the repository to the current format.",
+		Help: "Rewrites a repository created by an older version of svcs, keeping its history.\n" +
+			"Commit ids change; the old and new ids are listed.",
+		NoRepository: true,
+		Run: func(args []string) error {
+			result, err := svcs.Upgrade(".")
+			if err != nil {
+				return err
+			}
+			switch outputFormat {
+			case FormatJSON:
+				return printJSON(result)
+			case FormatPorcelain:
+				for _, renamed := range result.Commits {
+					fmt.Printf("%s %s\n", renamed.Old, renamed.New)
+				}
+				return nil
+			}
+			if result.From == result.To {
+				fmt.Printf("The repository is already in format %d.\n", result.To)
+				return nil
+			}
+			fmt.Printf("Upgraded the repository from format %d to %d.\n", result.From, result.To)
+			for _, renamed := range result.Commits {
+				fmt.Printf("%s -> %s\n", renamed.Old, renamed.New)
+			}
+			return nil
+		},
+	})
+}
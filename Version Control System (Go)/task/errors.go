@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+
+	"vcs/svcs"
+)
+
+// Exit codes, documented in the README.
+const (
+	ExitOK              = 0
+	ExitFailure         = 1
+	ExitUsage           = 2
+	ExitNotARepo        = 3
+	ExitUnknownRevision = 4
+	ExitNothingToCommit = 5
+	ExitConflict        = 6
+	ExitIO              = 7
+	ExitFormat          = 8
+	ExitCorrupt         = 9
+)
+
+// ErrUsage is the kind of errors caused by bad command lines.
+var ErrUsage = errors.New("usage error")
+
+var exitCodes = []struct {
+	kind error
+	name string
+	code int
+}{
+	{ErrUsage, "usage", ExitUsage},
+	{svcs.ErrNotARepo, "not-a-repo", ExitNotARepo},
+	{svcs.ErrUnknownRevision, "unknown-revision", ExitUnknownRevision},
+	{svcs.ErrNothingToCommit, "nothing-to-commit", ExitNothingToCommit},
+	{svcs.ErrConflict, "conflict", ExitConflict},
+	{svcs.ErrIO, "io-failure", ExitIO},
+	{svcs.ErrFormat, "format", ExitFormat},
+	{svcs.ErrCorrupt, "corrupt", ExitCorrupt},
+}
+
+func usageError(format string, a ...any) error {
+	return svcs.NewError(ErrUsage, format, a...)
+}
+
+// ErrorKind returns the documented name of the kind of err.
+func ErrorKind(err error) string {
+	for _, e := range exitCodes {
+		if errors.Is(err, e.kind) {
+			return e.name
+		}
+	}
+	return "failure"
+}
+
+// ExitCode maps err to the process exit code.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	for _, e := range exitCodes {
+		if errors.Is(err, e.kind) {
+			return e.code
+		}
+	}
+	return ExitFailure
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"vcs/svcs"
+)
+
+// graph draws the history of log --graph as ASCII lanes, one commit at a
+// time. Each lane holds the commit it leads to, "" once it has ended.
+type graph struct {
+	lanes []string
+}
+
+// draw returns the lines of text, which describe the commit id, prefixed
+// with the lanes, followed by the lines that lead the lanes on to parents.
+func (g *graph) draw(id string, parents []string, text []string) []string {
+	col := slices.Index(g.lanes, id)
+	if col < 0 {
+		g.lanes = append(g.lanes, id)
+		col = len(g.lanes) - 1
+	}
+	node := g.row(nil)
+	node[2*col] = '*'
+	lines := []string{withPrefix(node, text[0])}
+
+	g.lanes[col] = ""
+	if len(parents) > 0 {
+		g.lanes[col], parents = parents[0], parents[1:]
+	}
+	// Every further parent of a merge opens a lane to the right of the commit
+	for i, parent := range parents {
+		pos := col + 1 + i
+		row := g.row(func(lane int) bool { return lane < pos })
+		row[2*pos-1] = '\\'
+		for lane := pos; lane < len(g.lanes); lane++ {
+			row[2*lane+1] = '\\'
+		}
+		lines = append(lines, strings.TrimRight(string(row), " "))
+		g.lanes = append(g.lanes[:pos], append([]string{parent}, g.lanes[pos:]...)...)
+	}
+	for _, line := range text[1:] {
+		lines = append(lines, withPrefix(g.row(nil), line))
+	}
+
+	// Lanes that ended or lead to the same commit as one on their left close
+	for {
+		end := -1
+		for i, lane := range g.lanes {
+			if lane == "" || slices.Contains(g.lanes[:i], lane) {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return lines
+		}
+		row := g.row(func(lane int) bool { return lane < end })
+		if g.lanes[end] != "" {
+			row[2*end-1] = '/'
+		}
+		for lane := end + 1; lane < len(g.lanes); lane++ {
+			row[2*lane-1] = '/'
+		}
+		if line := strings.TrimRight(string(row), " "); line != g.rowString() {
+			lines = append(lines, line)
+		}
+		g.lanes = append(g.lanes[:end], g.lanes[end+1:]...)
+	}
+}
+
+// row returns the lanes for which keep reports true, or all of them if keep
+// is nil, as '|' at every other column.
+func (g *graph) row(keep func(lane int) bool) []byte {
+	row := []byte(strings.Repeat(" ", 2*len(g.lanes)))
+	for i, lane := range g.lanes {
+		if lane != "" && (keep == nil || keep(i)) {
+			row[2*i] = '|'
+		}
+	}
+	return row
+}
+
+func (g *graph) rowString() string {
+	return strings.TrimRight(string(g.row(nil)), " ")
+}
+
+func withPrefix(row []byte, text string) string {
+	return strings.TrimRight(string(row)+text, " ")
+}
+
+// shownParents returns the parents of commit as the graph draws them: a
+// parent that log leaves out is replaced by its nearest ancestors in shown.
+// known remembers the ancestors found for the commits left out.
+func shownParents(commit *svcs.Commit, shown map[string]bool, known map[string][]string) ([]string, error) {
+	var parents []string
+	for _, parent := range commit.Parents {
+		found := []string{parent}
+		if !shown[parent] {
+			var ok bool
+			if found, ok = known[parent]; !ok {
+				hidden, err := repo.ReadCommit(parent)
+				if err != nil {
+					return nil, err
+				}
+				if found, err = shownParents(hidden, shown, known); err != nil {
+					return nil, err
+				}
+				known[parent] = found
+			}
+		}
+		for _, id := range found {
+			if !slices.Contains(parents, id) {
+				parents = append(parents, id)
+			}
+		}
+	}
+	return parents, nil
+}
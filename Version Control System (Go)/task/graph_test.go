@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	tests := []struct {
+		name    string
+		commits [][]string // id then parents, in log order
+		want    string
+	}{
+		{"linear", [][]string{{"c", "b"}, {"b", "a"}, {"a"}}, `
+* c
+* b
+* a`},
+		{"branches", [][]string{{"d", "b"}, {"c", "b"}, {"b", "a"}, {"a"}}, `
+* d
+| * c
+|/
+* b
+* a`},
+		{"merge", [][]string{{"m", "c", "d"}, {"d", "b"}, {"c", "b"}, {"b", "a"}, {"a"}}, `
+* m
+|\
+| * d
+* | c
+|/
+* b
+* a`},
+		{"root beside a lane", [][]string{{"c", "a"}, {"x"}, {"a"}}, `
+* c
+| * x
+* a`},
+		{"ended lane on the left", [][]string{{"x"}, {"c", "a"}, {"b"}, {"a"}}, `
+* x
+* c
+| * b
+* a`},
+		{"lanes move left", [][]string{{"d", "a"}, {"e", "b"}, {"a"}, {"b"}}, `
+* d
+| * e
+* | a
+ /
+* b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var g graph
+			var lines []string
+			for _, commit := range tt.commits {
+				lines = append(lines, g.draw(commit[0], commit[1:], []string{commit[0]})...)
+			}
+			if got := "\n" + strings.Join(lines, "\n"); got != tt.want {
+				t.Errorf("graph:%s\nwant:%s", got, tt.want)
+			}
+		})
+	}
+}
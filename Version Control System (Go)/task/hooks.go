@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// hooksDir holds the hooks inside the vcs directory: executables named after
+// the point of a command where they run.
+const hooksDir = "hooks"
+
+// Hooks, in the order a commit or a checkout runs them.
+const (
+	// hookPreCommit runs before a commit is made; failing aborts it.
+	hookPreCommit = "pre-commit"
+	// hookCommitMsg gets the file of the message, which it may rewrite;
+	// failing aborts the commit.
+	hookCommitMsg = "commit-msg"
+	// hookPostCommit gets the id of the new commit.
+	hookPostCommit = "post-commit"
+	// hookPostCheckout gets the ids of the previous and the new HEAD, and 1.
+	hookPostCheckout = "post-checkout"
+)
+
+// findHook returns the path of the hook name if it exists and is executable,
+// or "". Hooks are programs, so only repositories on the local filesystem
+// have them.
+func findHook(name string) (string, error) {
+	dir := repo.StorageDir()
+	if dir == "" {
+		return "", nil
+	}
+	path := filepath.Join(dir, hooksDir, name)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return "", nil
+	}
+	return path, nil
+}
+
+// runHook runs the hook name with args from the top of the work tree, if
+// there is one, and fails if it does. Its output goes to the standard error
+// so as not to mix with the output of the command.
+func runHook(name string, args ...string) error {
+	path, err := findHook(name)
+	if path == "" || err != nil {
+		return err
+	}
+	hook := exec.Command(path, args...)
+	hook.Dir = repo.WorkTreeDir()
+	hook.Stdin, hook.Stdout, hook.Stderr = os.Stdin, os.Stderr, os.Stderr
+	var exitErr *exec.ExitError
+	if err = hook.Run(); errors.As(err, &exitErr) {
+		return fmt.Errorf("the %s hook failed with exit status %d", name, exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("the %s hook: %w", name, err)
+	}
+	return nil
+}
+
+// notifyHook runs the hook name with args after the command has done its
+// work, which its failure can't undo, so it only warns about it.
+func notifyHook(name string, args ...string) {
+	if err := runHook(name, args...); err != nil {
+		fmt.Fprintln(os.Stderr, "warning: "+err.Error())
+	}
+}
+
+// checkMessage has the commit-msg hook check message, which it gets in a
+// file that it may rewrite, and returns the message as the hook leaves it.
+func checkMessage(message string) (string, error) {
+	if path, err := findHook(hookCommitMsg); path == "" || err != nil {
+		return message, err
+	}
+	store := repo.Storage()
+	if err := store.WriteFile(editMessageFilename, []byte(message+"\n")); err != nil {
+		return "", err
+	}
+	if err := runHook(hookCommitMsg, storagePath(editMessageFilename)); err != nil {
+		return "", err
+	}
+	data, err := store.ReadFile(editMessageFilename)
+	if err != nil {
+		return "", err
+	}
+	return cleanMessage(string(data), false), nil
+}
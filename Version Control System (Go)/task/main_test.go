@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the transcripts in testdata with the current output")
+
+// TestTranscripts replays each testdata/*.txt session in a fresh directory. A
+// session is a series of "$ " lines, each followed by its output and, when it
+// fails, "[exit N]". Besides "$ svcs ...", "$ write <file> <Go string>",
+// "$ chmod <octal mode> <file>" and "$ rm <file>" change the work tree.
+func TestTranscripts(t *testing.T) {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		// Sessions run in their own directory
+		if name, err = filepath.Abs(name); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(strings.TrimSuffix(filepath.Base(name), ".txt"), func(t *testing.T) {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := replay(t, commandLines(string(data)))
+			if *update {
+				if err = os.WriteFile(name, []byte(got), 0666); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if got != string(data) {
+				t.Errorf("transcript differs; got:\n%s", got)
+			}
+		})
+	}
+}
+
+func commandLines(transcript string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(transcript))
+	for scanner.Scan() {
+		if line, ok := strings.CutPrefix(scanner.Text(), "$ "); ok {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func replay(t *testing.T, lines []string) string {
+	chdir(t, t.TempDir())
+	home := t.TempDir()
+	t.Setenv("SVCS_CONFIG_GLOBAL", filepath.Join(home, "user"))
+	t.Setenv("SVCS_CONFIG_SYSTEM", filepath.Join(home, "system"))
+	t.Setenv("SVCS_AUTHOR_DATE", "2024-05-01T12:00:00Z")
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	var out strings.Builder
+	for _, line := range lines {
+		fmt.Fprintf(&out, "$ %s\n", line)
+		name, rest, _ := strings.Cut(line, " ")
+		switch name {
+		case "svcs":
+			args, err := SplitArgs(rest)
+			if err != nil {
+				t.Fatalf("%s: %v", line, err)
+			}
+			var code int
+			out.WriteString(capture(t, func() { code = run(args) }))
+			if code != 0 {
+				fmt.Fprintf(&out, "[exit %d]\n", code)
+			}
+		case "write":
+			file, content, _ := strings.Cut(rest, " ")
+			content, err := strconv.Unquote(content)
+			if err == nil {
+				if err = os.MkdirAll(filepath.Dir(file), 0777); err == nil {
+					err = os.WriteFile(file, []byte(content), 0666)
+				}
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", line, err)
+			}
+		case "chmod":
+			mode, file, _ := strings.Cut(rest, " ")
+			perm, err := strconv.ParseUint(mode, 8, 32)
+			if err == nil {
+				err = os.Chmod(file, os.FileMode(perm))
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", line, err)
+			}
+		case "rm":
+			if err := os.Remove(rest); err != nil {
+				t.Fatalf("%s: %v", line, err)
+			}
+		default:
+			t.Fatalf("unknown transcript command %q", line)
+		}
+	}
+	return out.String()
+}
+
+// capture returns what f writes to the standard output and error.
+func capture(t *testing.T, f func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = writer, writer
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+	defer func() {
+		os.Stdout, os.Stderr = stdout, stderr
+	}()
+	f()
+	writer.Close()
+	return <-output
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
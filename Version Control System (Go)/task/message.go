@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"vcs/svcs"
+)
+
+// editMessageFilename is where the message is edited, inside the vcs directory.
+const editMessageFilename = "COMMIT_EDITMSG"
+
+var errEmptyMessage = errors.New("aborting commit due to empty commit message")
+
+// paragraphsFlag collects the values of a flag that can be repeated.
+type paragraphsFlag []string
+
+func (f *paragraphsFlag) String() string { return strings.Join(*f, "\n\n") }
+
+func (f *paragraphsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// readMessage returns the message in the file name, or standard input for "-".
+func readMessage(name string) (string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return cleanMessage(string(data), false), nil
+}
+
+// messageEditor returns the command that edits messages: core.editor,
+// $VISUAL or $EDITOR, or "" if none is set.
+func messageEditor() string {
+	editor := repo.Config.GetString("core.editor")
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor == "" {
+			editor = os.Getenv(name)
+		}
+	}
+	return editor
+}
+
+// editMessage has the user write the message with the command editor,
+// starting from a template that lists the staged changes, and returns it
+// without the comment lines.
+func editMessage(editor string) (string, error) {
+	statuses, err := repo.Status()
+	if err != nil {
+		return "", err
+	}
+	var template strings.Builder
+	template.WriteString("\n")
+	template.WriteString("# Enter the commit message. Lines starting with '#' are ignored,\n")
+	template.WriteString("# and an empty message aborts the commit.\n")
+	staged := false
+	for _, status := range statuses {
+		if status.Staged == svcs.StateUnmodified || status.Staged == svcs.StateUntracked {
+			continue
+		}
+		if !staged {
+			template.WriteString("#\n# Changes to be committed:\n")
+			staged = true
+		}
+		fmt.Fprintf(&template, "#\t%-11s %s\n", status.Staged+":", status.Path)
+	}
+	store := repo.Storage()
+	if err = store.WriteFile(editMessageFilename, []byte(template.String())); err != nil {
+		return "", err
+	}
+	// The editor is a shell command, which may have arguments of its own
+	run := exec.Command("sh", "-c", editor+` "$@"`, editor, storagePath(editMessageFilename))
+	run.Dir = repo.WorkTreeDir()
+	run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = run.Run(); err != nil {
+		return "", fmt.Errorf("editor '%s' failed: %w", editor, err)
+	}
+	data, err := store.ReadFile(editMessageFilename)
+	if err != nil {
+		return "", err
+	}
+	return cleanMessage(string(data), true), nil
+}
+
+// storagePath returns the path of the file name of the vcs directory as
+// programs run from the top of the work tree see it.
+func storagePath(name string) string {
+	path := filepath.Join(repo.StorageDir(), name)
+	if rel, err := filepath.Rel(repo.WorkTreeDir(), path); err == nil && filepath.IsLocal(rel) {
+		return rel
+	}
+	return path
+}
+
+// cleanMessage removes trailing spaces, leading and trailing blank lines and
+// repeated blank lines from message and, if stripComments is set, the lines
+// that start with "#".
+func cleanMessage(message string, stripComments bool) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" && (len(lines) == 0 || lines[len(lines)-1] == "") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestCleanMessage(t *testing.T) {
+	tests := []struct {
+		message       string
+		stripComments bool
+		want          string
+	}{
+		{"subject", false, "subject"},
+		{"\n\nsubject  \n\n\n\nbody\t\n\n", false, "subject\n\nbody"},
+		{"subject\n# comment\n\n# more\nbody\n", true, "subject\n\nbody"},
+		{"subject\n# kept\n", false, "subject\n# kept"},
+		{"# only comments\n#\n", true, ""},
+		{"", false, ""},
+	}
+	for _, tt := range tests {
+		if got := cleanMessage(tt.message, tt.stripComments); got != tt.want {
+			t.Errorf("cleanMessage(%q, %v) = %q, want %q", tt.message, tt.stripComments, got, tt.want)
+		}
+	}
+}
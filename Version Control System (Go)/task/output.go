@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"vcs/svcs"
+)
+
+// Output formats selected with --format or --porcelain.
+const (
+	FormatText      = "text"
+	FormatJSON      = "json"
+	FormatPorcelain = "porcelain"
+)
+
+var outputFormat = FormatText
+
+// dateFormat is how dates are shown in text output.
+const dateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+
+// shortHashLength is the length of abbreviated commit hashes.
+const shortHashLength = 7
+
+// logEntry is a commit as log shows it, with the names of the branches and
+// tags pointing to it.
+type logEntry struct {
+	*svcs.Commit
+	decoration string
+}
+
+// placeholders are the fields of a commit that a log --pretty template can show.
+var placeholders = map[string]func(entry logEntry) string{
+	"H":  func(entry logEntry) string { return entry.Hash },
+	"h":  func(entry logEntry) string { return entry.Hash[:shortHashLength] },
+	"an": func(entry logEntry) string { return entry.Author },
+	"ae": func(entry logEntry) string { return entry.Email },
+	"ad": func(entry logEntry) string { return entry.Date.Format(dateFormat) },
+	"s":  func(entry logEntry) string { return entry.Subject() },
+	"d":  func(entry logEntry) string { return entry.decoration },
+	"n":  func(entry logEntry) string { return "\n" },
+	"%":  func(entry logEntry) string { return "%" },
+}
+
+// formatCommit fills in the placeholders of template for commit, with the
+// names pointing to it in decoration. Unknown placeholders are kept as they are.
+func formatCommit(template string, commit *svcs.Commit, decoration string) string {
+	entry := logEntry{commit, decoration}
+	var b strings.Builder
+	for {
+		before, after, ok := strings.Cut(template, "%")
+		b.WriteString(before)
+		if !ok {
+			return b.String()
+		}
+		template = after
+		field := "%"
+		for name, value := range placeholders {
+			if rest, ok := strings.CutPrefix(template, name); ok {
+				field, template = value(entry), rest
+				break
+			}
+		}
+		b.WriteString(field)
+	}
+}
+
+func setOutputFormat(value string) error {
+	switch value {
+	case FormatText, FormatJSON, FormatPorcelain:
+		outputFormat = value
+		return nil
+	}
+	return fmt.Errorf("unknown format '%s', expected text, json or porcelain", value)
+}
+
+type formatFlag struct{}
+
+func (formatFlag) String() string         { return outputFormat }
+func (formatFlag) Set(value string) error { return setOutputFormat(value) }
+
+type porcelainFlag struct{}
+
+func (porcelainFlag) String() string   { return "false" }
+func (porcelainFlag) IsBoolFlag() bool { return true }
+func (porcelainFlag) Set(value string) error {
+	if b, err := svcs.ParseBool(value); err != nil || !b {
+		return err
+	}
+	return setOutputFormat(FormatPorcelain)
+}
+
+type jsonFlag struct{}
+
+func (jsonFlag) String() string   { return "false" }
+func (jsonFlag) IsBoolFlag() bool { return true }
+func (jsonFlag) Set(value string) error {
+	if b, err := svcs.ParseBool(value); err != nil || !b {
+		return err
+	}
+	return setOutputFormat(FormatJSON)
+}
+
+// withFormats registers --format and --porcelain on cmd.
+func withFormats(cmd *Command) *Command {
+	cmd.Flags().Var(formatFlag{}, "format", "output `format`: text, json or porcelain")
+	cmd.Flags().Var(porcelainFlag{}, "porcelain", "stable text output for scripts, same as --format=porcelain")
+	return cmd
+}
+
+func (cmd *Command) HasFormats() bool {
+	return cmd.Flags().Lookup("format") != nil
+}
+
+// parseGlobalOptions consumes the options given before the command name.
+func parseGlobalOptions(args []string) ([]string, error) {
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case strings.HasPrefix(arg, "--format="):
+			if err := setOutputFormat(strings.TrimPrefix(arg, "--format=")); err != nil {
+				return nil, usageError("%v", err)
+			}
+		case arg == "--format":
+			if len(args) < 2 {
+				return nil, usageError("--format needs a value")
+			}
+			if err := setOutputFormat(args[1]); err != nil {
+				return nil, usageError("%v", err)
+			}
+			args = args[1:]
+		case arg == "--porcelain":
+			outputFormat = FormatPorcelain
+		default:
+			return args, nil
+		}
+		args = args[1:]
+	}
+	return args, nil
+}
+
+func printJSON(v any) error {
+	return writeJSON(os.Stdout, v)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+type jsonError struct {
+	Error struct {
+		Kind     string `json:"kind"`
+		Message  string `json:"message"`
+		ExitCode int    `json:"exitCode"`
+	} `json:"error"`
+}
+
+func printError(err error) {
+	if outputFormat != FormatJSON {
+		fmt.Fprintln(os.Stderr, "error: "+err.Error())
+		return
+	}
+	var out jsonError
+	out.Error.Kind = ErrorKind(err)
+	out.Error.Message = err.Error()
+	out.Error.ExitCode = ExitCode(err)
+	writeJSON(os.Stderr, out)
+}
+
+// formatSize returns a number of bytes in a readable form, e.g. "1.5 KiB".
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, unit := float64(size)/1024, "KiB"
+	for _, next := range []string{"MiB", "GiB"} {
+		if value < 1024 {
+			break
+		}
+		value, unit = value/1024, next
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
@@ -0,0 +1,231 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+)
+
+// bisectFilename holds the state of a bisection while one is in progress.
+const bisectFilename = "bisect.txt"
+
+// Bisect terms, the verdicts on a commit.
+const (
+	BisectGood = "good"
+	BisectBad  = "bad"
+	BisectSkip = "skip"
+)
+
+var errNotBisecting = errors.New("not bisecting, run 'svcs bisect start' first")
+
+// bisectState is the contents of bisect.txt.
+type bisectState struct {
+	// Start is the branch, or the commit id, that HEAD was on before the bisection.
+	Start string   `json:"start"`
+	Bad   string   `json:"bad,omitempty"`
+	Good  []string `json:"good"`
+	Skip  []string `json:"skip"`
+}
+
+// BisectResult is where a bisection stands after a step. If neither Next nor
+// Found is set and Skipped is empty, a good or a bad commit is still missing.
+type BisectResult struct {
+	// Next is the commit checked out to be tested next.
+	Next *Commit
+	// Left is at most how many commits will remain to be tested after Next.
+	Left int
+	// Found is the first bad commit, once it is known.
+	Found *Commit
+	// Skipped lists the commits that may be the first bad one when only
+	// skipped commits remain to be tested.
+	Skipped []string
+}
+
+// BisectStart begins a binary search for the commit that introduced a
+// regression. bad and good, if given, are marked as by BisectMark.
+func (repo *Repository) BisectStart(bad string, good []string) (*BisectResult, error) {
+	if state, err := repo.readBisect(); err != nil {
+		return nil, err
+	} else if state != nil {
+		return nil, errors.New("already bisecting, run 'svcs bisect reset' first")
+	}
+	if repo.head == "" {
+		return nil, NewError(ErrUnknownRevision, "there are no commits yet")
+	}
+	state := &bisectState{Start: repo.branch, Good: []string{}, Skip: []string{}}
+	if state.Start == "" {
+		state.Start = repo.head
+	}
+	if bad != "" {
+		commit, err := repo.ResolveRevision(bad)
+		if err != nil {
+			return nil, err
+		}
+		state.Bad = commit.Hash
+	}
+	for _, rev := range good {
+		commit, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return nil, err
+		}
+		state.Good = append(state.Good, commit.Hash)
+	}
+	return repo.bisectNext(state)
+}
+
+// BisectMark records the verdict term, BisectGood, BisectBad or BisectSkip,
+// on the revision rev and checks out the next commit to test.
+func (repo *Repository) BisectMark(term, rev string) (*BisectResult, error) {
+	state, err := repo.readBisect()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errNotBisecting
+	}
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	switch term {
+	case BisectGood:
+		state.Good = append(state.Good, commit.Hash)
+	case BisectBad:
+		state.Bad = commit.Hash
+	case BisectSkip:
+		state.Skip = append(state.Skip, commit.Hash)
+	default:
+		return nil, fmt.Errorf("unknown bisect term '%s'", term)
+	}
+	return repo.bisectNext(state)
+}
+
+// BisectReset ends the bisection and checks out the branch or commit that
+// was current when it started.
+func (repo *Repository) BisectReset() (*Commit, error) {
+	state, err := repo.readBisect()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errNotBisecting
+	}
+	commit, err := repo.Checkout(state.Start)
+	if err != nil {
+		return nil, err
+	}
+	return commit, ioError(repo.store.Remove(bisectFilename))
+}
+
+// readBisect loads the bisection state, or returns nil if there is none.
+func (repo *Repository) readBisect() (*bisectState, error) {
+	data, err := repo.store.ReadFile(bisectFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ioError(err)
+	}
+	var state bisectState
+	if err = decodeStrict(bisectFilename, data, &state); err != nil {
+		return nil, err
+	}
+	for _, id := range append(append([]string{state.Bad}, state.Good...), state.Skip...) {
+		if id != "" && !ValidID(id) {
+			return nil, corruptError(bisectFilename, "bad commit id '%s'", id)
+		}
+	}
+	if state.Start == "" {
+		return nil, corruptError(bisectFilename, "missing start")
+	}
+	return &state, nil
+}
+
+// bisectNext saves state and, once a bad and a good commit are known, checks
+// out the candidate that best halves the commits that may have introduced
+// the regression: those that lead to the bad commit but not to a good one.
+func (repo *Repository) bisectNext(state *bisectState) (*BisectResult, error) {
+	result, err := repo.bisectStep(state)
+	if err != nil {
+		return nil, err
+	}
+	if err = repo.writeJSON(bisectFilename, state); err != nil {
+		return nil, err
+	}
+	if result.Next != nil {
+		if _, err = repo.Checkout(result.Next.Hash); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// bisectStep works out where the bisection of state stands.
+func (repo *Repository) bisectStep(state *bisectState) (*BisectResult, error) {
+	if state.Bad == "" || len(state.Good) == 0 {
+		return &BisectResult{}, nil
+	}
+	good, err := repo.history(state.Good)
+	if err != nil {
+		return nil, err
+	}
+	isGood := map[string]bool{}
+	for _, commit := range good {
+		isGood[commit.Hash] = true
+	}
+	if isGood[state.Bad] {
+		return nil, fmt.Errorf("the bad commit %s is an ancestor of a good one", state.Bad)
+	}
+	history, err := repo.history([]string{state.Bad})
+	if err != nil {
+		return nil, err
+	}
+	candidates := map[string]*Commit{}
+	for _, commit := range history {
+		if !isGood[commit.Hash] {
+			candidates[commit.Hash] = commit
+		}
+	}
+	if len(candidates) == 1 {
+		return &BisectResult{Found: candidates[state.Bad]}, nil
+	}
+
+	// Testing a commit settles either the candidates that lead to it or all
+	// the others; the best one leaves the fewest in the worst case
+	var next *Commit
+	left := len(candidates)
+	for _, commit := range history {
+		if candidates[commit.Hash] == nil || commit.Hash == state.Bad || slices.Contains(state.Skip, commit.Hash) {
+			continue
+		}
+		ancestors := countAncestors(commit, candidates)
+		if worst := max(ancestors, len(candidates)-ancestors); worst < left {
+			next, left = commit, worst
+		}
+	}
+	if next == nil {
+		result := &BisectResult{Skipped: []string{}}
+		for _, commit := range history {
+			if candidates[commit.Hash] != nil {
+				result.Skipped = append(result.Skipped, commit.Hash)
+			}
+		}
+		return result, nil
+	}
+	return &BisectResult{Next: next, Left: left - 1}, nil
+}
+
+// countAncestors returns how many of candidates lead to commit, counting commit itself.
+func countAncestors(commit *Commit, candidates map[string]*Commit) int {
+	seen := map[string]bool{commit.Hash: true}
+	for queue := []*Commit{commit}; len(queue) > 0; queue = queue[1:] {
+		for _, parent := range queue[0].Parents {
+			if candidate := candidates[parent]; candidate != nil && !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, candidate)
+			}
+		}
+	}
+	return len(seen)
+}
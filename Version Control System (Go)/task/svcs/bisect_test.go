@@ -0,0 +1,80 @@
+package svcs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newBisectRepository returns a repository with 10 commits of a.txt, from
+// "v0" to "v9", the bug appearing in v6.
+func newBisectRepository(t *testing.T) (*Repository, []*Commit) {
+	t.Helper()
+	repo := newTestRepository(t)
+	var commits []*Commit
+	for i := 0; i < 10; i++ {
+		content := fmt.Sprintf("v%d", i)
+		if i >= 6 {
+			content += " bug"
+		}
+		writeFile(t, repo.WorkTree(), "a.txt", content)
+		mustAdd(t, repo, "a.txt")
+		commits = append(commits, mustCommit(t, repo, fmt.Sprintf("v%d", i)))
+	}
+	return repo, commits
+}
+
+func TestBisect(t *testing.T) {
+	repo, commits := newBisectRepository(t)
+	result, err := repo.BisectStart("", nil)
+	if err != nil || result.Next != nil || result.Found != nil {
+		t.Fatalf("BisectStart() = %+v, %v", result, err)
+	}
+	if result, err = repo.BisectMark(BisectBad, Head); err != nil || result.Next != nil {
+		t.Fatalf("BisectMark(bad) = %+v, %v", result, err)
+	}
+	result, err = repo.BisectMark(BisectGood, commits[0].Hash)
+	steps := 0
+	for ; err == nil && result.Next != nil; steps++ {
+		if repo.head != result.Next.Hash {
+			t.Fatalf("HEAD is %s, not the commit to test %s", repo.head, result.Next.Hash)
+		}
+		term := BisectGood
+		if strings.Contains(readFile(t, repo.WorkTree(), "a.txt"), "bug") {
+			term = BisectBad
+		}
+		result, err = repo.BisectMark(term, Head)
+	}
+	if err != nil || result.Found == nil || result.Found.Hash != commits[6].Hash {
+		t.Fatalf("bisection ended with %+v, %v, want %s", result, err, commits[6].Hash)
+	}
+	if steps > 4 {
+		t.Errorf("bisection took %d steps for 9 commits", steps)
+	}
+
+	if _, err = repo.BisectStart("", nil); err == nil {
+		t.Errorf("BisectStart() while bisecting succeeded")
+	}
+	commit, err := repo.BisectReset()
+	if err != nil || commit.Hash != commits[9].Hash || repo.Branch() != DefaultBranch {
+		t.Errorf("BisectReset() = %v, %v, on branch %q", commit, err, repo.Branch())
+	}
+	if _, err = repo.BisectMark(BisectGood, Head); err == nil {
+		t.Errorf("BisectMark() after reset succeeded")
+	}
+}
+
+func TestBisectSkip(t *testing.T) {
+	repo, commits := newBisectRepository(t)
+	result, err := repo.BisectStart(commits[7].Hash, []string{commits[5].Hash})
+	if err != nil || result.Next == nil || result.Next.Hash != commits[6].Hash {
+		t.Fatalf("BisectStart() = %+v, %v, want %s next", result, err, commits[6].Hash)
+	}
+	result, err = repo.BisectMark(BisectSkip, Head)
+	if err != nil || len(result.Skipped) != 2 || result.Skipped[0] != commits[7].Hash || result.Skipped[1] != commits[6].Hash {
+		t.Errorf("BisectMark(skip) = %+v, %v", result, err)
+	}
+	if _, err = repo.BisectMark(BisectGood, commits[8].Hash); err == nil {
+		t.Errorf("marking a descendant of the bad commit good succeeded")
+	}
+}
@@ -0,0 +1,157 @@
+package svcs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BlameLine is a line of a file together with the commit that last changed it.
+type BlameLine struct {
+	// Line is the 1-based line number in the blamed version of the file.
+	Line   int       `json:"line"`
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Email  string    `json:"email,omitempty"`
+	Date   time.Time `json:"date"`
+	Text   string    `json:"text"`
+}
+
+// blameVersion is a version of the blamed file as of a commit.
+type blameVersion struct {
+	id    string
+	lines []string
+}
+
+// blamed is a line of a version of the blamed file whose commit is not known
+// yet: the index of the line in that version and in the blamed one.
+type blamed struct {
+	line, final int
+}
+
+// Blame returns the lines of the file name as of the revision rev, each with
+// the commit that last changed it. Lines that a commit has in common with a
+// parent, according to DiffLines, are passed on to that parent; the others
+// are that commit's.
+func (repo *Repository) Blame(rev, name string) ([]BlameLine, error) {
+	start, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	clean, err := CleanPath(name)
+	if err != nil {
+		return nil, err
+	}
+	versions := map[string]*blameVersion{}
+	version, err := repo.blameVersion(start, clean, versions)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		return nil, NewError(ErrUnknownRevision, "'%s' does not exist in '%s'", name, rev)
+	}
+	result := make([]BlameLine, len(version.lines))
+	pending := map[string][]blamed{}
+	for i := range version.lines {
+		pending[start.Hash] = append(pending[start.Hash], blamed{i, i})
+	}
+	history, err := repo.history([]string{start.Hash})
+	if err != nil {
+		return nil, err
+	}
+	left := len(version.lines)
+	for _, commit := range history {
+		if left == 0 {
+			break
+		}
+		lines := pending[commit.Hash]
+		if len(lines) == 0 {
+			continue
+		}
+		delete(pending, commit.Hash)
+		current := versions[commit.Hash]
+		delete(versions, commit.Hash)
+		for _, parentID := range commit.Parents {
+			parent, err := repo.ReadCommit(parentID)
+			if err != nil {
+				return nil, err
+			}
+			old, err := repo.blameVersion(parent, clean, versions)
+			if err != nil {
+				return nil, err
+			}
+			if old == nil {
+				continue
+			}
+			lines = passLines(lines, current, old, func(line blamed) {
+				pending[parentID] = append(pending[parentID], line)
+			})
+		}
+		for _, line := range lines {
+			result[line.final] = BlameLine{
+				Line:   line.final + 1,
+				Commit: commit.Hash,
+				Author: commit.Author,
+				Email:  commit.Email,
+				Date:   commit.Date,
+				Text:   strings.TrimSuffix(current.lines[line.line], "\n"),
+			}
+			left--
+		}
+	}
+	return result, nil
+}
+
+// blameVersion returns the version of the file name as of commit, or nil if
+// it does not have the file. Versions are read once and kept in versions.
+func (repo *Repository) blameVersion(commit *Commit, name string, versions map[string]*blameVersion) (*blameVersion, error) {
+	if version, ok := versions[commit.Hash]; ok {
+		return version, nil
+	}
+	snap, err := repo.readTree(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	var version *blameVersion
+	if id := snap.lookup(name); id != "" {
+		kind, data, err := repo.readFile(id)
+		if err != nil {
+			return nil, err
+		}
+		if kind == ObjectPointer {
+			return nil, fmt.Errorf("'%s' is a large file in %s, which can't be blamed", name, commit.Hash)
+		}
+		version = &blameVersion{id, SplitLines(data)}
+	}
+	versions[commit.Hash] = version
+	return version, nil
+}
+
+// passLines hands the lines of version that old also has to pass, at their
+// position in old, and returns the others.
+func passLines(lines []blamed, version, old *blameVersion, pass func(blamed)) []blamed {
+	at := make([]int, len(version.lines))
+	if version.id == old.id {
+		for i := range at {
+			at[i] = i
+		}
+	} else {
+		for i := range at {
+			at[i] = -1
+		}
+		for _, edit := range DiffLines(old.lines, version.lines) {
+			if edit.Op == OpEqual {
+				at[edit.NewLine] = edit.OldLine
+			}
+		}
+	}
+	var rest []blamed
+	for _, line := range lines {
+		if at[line.line] >= 0 {
+			pass(blamed{at[line.line], line.final})
+		} else {
+			rest = append(rest, line)
+		}
+	}
+	return rest
+}
@@ -0,0 +1,68 @@
+package svcs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBlame(t *testing.T) {
+	repo := newTestRepository(t)
+	var commits []*Commit
+	for _, step := range []struct {
+		author, content string
+	}{
+		{"Ann", "a\nb\nc\n"},
+		{"Bob", "b\nc\nx\na\n"},
+		{"Cy", "b\nC\nx\na\n"},
+		{"Ann", "b\nC\nx\na\ny"},
+	} {
+		if err := repo.Config.Set(ScopeRepository, "user.name", step.author); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, repo.WorkTree(), "f.txt", step.content)
+		writeFile(t, repo.WorkTree(), "other.txt", step.author)
+		mustAdd(t, repo, "f.txt", "other.txt")
+		commits = append(commits, mustCommit(t, repo, step.author))
+	}
+
+	lines, err := repo.Blame("HEAD", "f.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		commit *Commit
+		text   string
+	}{
+		{commits[0], "b"},
+		{commits[2], "C"},
+		{commits[1], "x"},
+		// The line moved; the diff sees it as added
+		{commits[1], "a"},
+		{commits[3], "y"},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Blame() = %+v, want %d lines", lines, len(want))
+	}
+	for i, line := range lines {
+		if line.Line != i+1 || line.Commit != want[i].commit.Hash || line.Author != want[i].commit.Author || line.Text != want[i].text {
+			t.Errorf("line %d = %+v, want %q by %s", i+1, line, want[i].text, want[i].commit.Author)
+		}
+	}
+
+	if lines, err = repo.Blame(commits[0].Hash, "f.txt"); err != nil || len(lines) != 3 || lines[2].Commit != commits[0].Hash {
+		t.Errorf("Blame() of the first commit = %+v, %v", lines, err)
+	}
+	if _, err = repo.Blame("HEAD", "missing.txt"); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("Blame() of a missing file: got %v, want ErrUnknownRevision", err)
+	}
+}
+
+func TestBlameLargeFile(t *testing.T) {
+	repo := newLargeRepository(t)
+	writeFile(t, repo.WorkTree(), "a.bin", "data\n")
+	mustAdd(t, repo, "a.bin")
+	mustCommit(t, repo, "first")
+	if _, err := repo.Blame("HEAD", "a.bin"); err == nil {
+		t.Errorf("Blame() of a large file succeeded")
+	}
+}
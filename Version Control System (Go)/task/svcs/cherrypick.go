@@ -0,0 +1,229 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// cherryPickFilename holds the state of a cherry-pick stopped by conflicts.
+const cherryPickFilename = "cherry-pick.txt"
+
+var errNotCherryPicking = errors.New("no cherry-pick in progress")
+
+// cherryPickState is the contents of cherry-pick.txt.
+type cherryPickState struct {
+	// Head is the commit that was current when the cherry-pick started.
+	Head string `json:"head"`
+	// Todo lists the commits left to pick, starting with the one that stopped.
+	Todo      []string `json:"todo"`
+	Conflicts []string `json:"conflicts"`
+}
+
+// CherryPickResult is the outcome of a cherry-pick.
+type CherryPickResult struct {
+	// Commits are the new commits, in order.
+	Commits []*Commit
+	// Empty lists the picked commits whose changes were already there, which
+	// were left out.
+	Empty []*Commit
+	// Stopped is the commit whose changes conflict with the current ones, if
+	// any, and Conflicts the files where they do. Once they are resolved and
+	// staged, CherryPickContinue commits them and picks the rest.
+	Stopped   *Commit
+	Conflicts []string
+}
+
+// CherryPick applies the changes of each of the revisions revs, relative to
+// its parent, on top of the current commit with a three-way merge and commits
+// them with the author, date and message of the original. The index and the
+// tracked files must not have changes.
+func (repo *Repository) CherryPick(revs []string) (*CherryPickResult, error) {
+	if err := repo.checkNoSequence(); err != nil {
+		return nil, err
+	}
+	if repo.head == "" {
+		return nil, NewError(ErrUnknownRevision, "there are no commits yet")
+	}
+	state := &cherryPickState{Head: repo.head, Todo: []string{}, Conflicts: []string{}}
+	for _, rev := range revs {
+		commit, err := repo.ResolveRevision(rev)
+		if err != nil {
+			return nil, err
+		}
+		state.Todo = append(state.Todo, commit.Hash)
+	}
+	if err := repo.requireClean("cherry-picking"); err != nil {
+		return nil, err
+	}
+	return repo.cherryPickNext(state, &CherryPickResult{})
+}
+
+// CherryPickContinue commits the resolved changes of the commit a cherry-pick
+// stopped at and picks the remaining ones.
+func (repo *Repository) CherryPickContinue() (*CherryPickResult, error) {
+	state, err := repo.readCherryPick()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errNotCherryPicking
+	}
+	if err = repo.checkResolved(state.Conflicts); err != nil {
+		return nil, err
+	}
+	commit, err := repo.ReadCommit(state.Todo[0])
+	if err != nil {
+		return nil, err
+	}
+	result := &CherryPickResult{}
+	if err = repo.commitPick(commit, result); err != nil {
+		return nil, err
+	}
+	state.Todo, state.Conflicts = state.Todo[1:], []string{}
+	return repo.cherryPickNext(state, result)
+}
+
+// CherryPickAbort ends a cherry-pick, returning to the commit that was current
+// when it started with its index and tracked files.
+func (repo *Repository) CherryPickAbort() (*Commit, error) {
+	state, err := repo.readCherryPick()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errNotCherryPicking
+	}
+	commit, err := repo.ReadCommit(state.Head)
+	if err != nil {
+		return nil, err
+	}
+	if err = repo.resetTo(commit, state.Conflicts, "cherry-pick: abort"); err != nil {
+		return nil, err
+	}
+	return commit, ioError(repo.store.Remove(cherryPickFilename))
+}
+
+// readCherryPick loads the cherry-pick state, or returns nil if there is none.
+func (repo *Repository) readCherryPick() (*cherryPickState, error) {
+	data, err := repo.store.ReadFile(cherryPickFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ioError(err)
+	}
+	var state cherryPickState
+	if err = decodeStrict(cherryPickFilename, data, &state); err != nil {
+		return nil, err
+	}
+	for _, id := range append([]string{state.Head}, state.Todo...) {
+		if !ValidID(id) {
+			return nil, corruptError(cherryPickFilename, "bad commit id '%s'", id)
+		}
+	}
+	if len(state.Todo) == 0 {
+		return nil, corruptError(cherryPickFilename, "no commit to pick")
+	}
+	return &state, nil
+}
+
+// cherryPickNext picks the commits of state.Todo in turn. If one conflicts,
+// it saves state to go on later; otherwise it clears it.
+func (repo *Repository) cherryPickNext(state *cherryPickState, result *CherryPickResult) (*CherryPickResult, error) {
+	for len(state.Todo) > 0 {
+		commit, err := repo.ReadCommit(state.Todo[0])
+		if err != nil {
+			return nil, err
+		}
+		conflicts, err := repo.pick(commit)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			state.Conflicts = conflicts
+			result.Stopped, result.Conflicts = commit, conflicts
+			return result, repo.writeJSON(cherryPickFilename, state)
+		}
+		if err = repo.commitPick(commit, result); err != nil {
+			return nil, err
+		}
+		state.Todo = state.Todo[1:]
+	}
+	if err := repo.store.Remove(cherryPickFilename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, ioError(err)
+	}
+	return result, nil
+}
+
+// pick merges the changes of commit relative to its parent into the index and
+// the work tree, and returns the files that conflict.
+func (repo *Repository) pick(commit *Commit) ([]string, error) {
+	var parent *Commit
+	if len(commit.Parents) > 0 {
+		var err error
+		if parent, err = repo.ReadCommit(commit.Parents[0]); err != nil {
+			return nil, err
+		}
+	}
+	base, err := repo.treeOf(parent)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := repo.readTree(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	files, err := repo.mergeSnapshots(base, repo.index, theirs, Head, pickLabel(commit))
+	if err != nil {
+		return nil, err
+	}
+	return repo.applyMerge(files)
+}
+
+// commitPick commits the index as the pick of commit, noting where its
+// message comes from, and adds it to result. If the index has no changes,
+// commit is added to the empty picks instead.
+func (repo *Repository) commitPick(commit *Commit, result *CherryPickResult) error {
+	message := fmt.Sprintf("%s\n\n(cherry picked from commit %s)", strings.TrimRight(commit.Message, "\n"), commit.Hash)
+	picked, err := repo.commitCopy(commit, message, "cherry-pick: ")
+	if err != nil {
+		return err
+	}
+	if picked == nil {
+		result.Empty = append(result.Empty, commit)
+	} else {
+		result.Commits = append(result.Commits, picked)
+	}
+	return nil
+}
+
+// commitCopy commits the index on top of the current commit with the author
+// and date of commit and message, noting command and the subject in the
+// reflog. It returns nil, committing nothing, if the index has no changes.
+func (repo *Repository) commitCopy(commit *Commit, message, command string) (*Commit, error) {
+	tree, err := repo.writeTree(repo.index)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	if head.Tree == tree {
+		return nil, nil
+	}
+	copied := &Commit{
+		Tree:    tree,
+		Parents: []string{head.Hash},
+		Author:  commit.Author,
+		Email:   commit.Email,
+		Date:    commit.Date,
+		Message: message,
+	}
+	if err = repo.writeCommit(copied); err != nil {
+		return nil, err
+	}
+	return copied, repo.moveHead(copied.Hash, command+copied.Subject())
+}
@@ -0,0 +1,134 @@
+package svcs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newPickRepository returns a repository whose main branch changes the first
+// line of a.txt, and the commit of a detached HEAD that changes its last line
+// to last, HEAD being back on main.
+func newPickRepository(t *testing.T, last string) (*Repository, *Commit) {
+	t.Helper()
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "1\n2\n3\n")
+	mustAdd(t, repo, "a.txt")
+	mustCommit(t, repo, "base")
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\n3\n")
+	mustAdd(t, repo, "a.txt")
+	mustCommit(t, repo, "first line")
+
+	if _, err := repo.Checkout("HEAD~1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "1\n2\n"+last)
+	writeFile(t, repo.WorkTree(), "b.txt", "b\n")
+	mustAdd(t, repo, "a.txt", "b.txt")
+	if err := repo.Config.Set(ScopeRepository, "user.name", "Bob"); err != nil {
+		t.Fatal(err)
+	}
+	side := mustCommit(t, repo, "last line\n\nDetails.")
+	if err := repo.Config.Set(ScopeRepository, "user.name", "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Checkout(DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	return repo, side
+}
+
+func TestCherryPick(t *testing.T) {
+	repo, side := newPickRepository(t, "three\n")
+	head := repo.head
+	result, err := repo.CherryPick([]string{side.Hash})
+	if err != nil || len(result.Commits) != 1 || result.Stopped != nil {
+		t.Fatalf("CherryPick() = %+v, %v", result, err)
+	}
+	picked := result.Commits[0]
+	if picked.Author != "Bob" || !picked.Date.Equal(side.Date) || !reflect.DeepEqual(picked.Parents, []string{head}) {
+		t.Errorf("picked commit = %+v", picked)
+	}
+	if want := "last line\n\nDetails.\n\n(cherry picked from commit " + side.Hash + ")"; picked.Message != want {
+		t.Errorf("message = %q, want %q", picked.Message, want)
+	}
+	if repo.head != picked.Hash || repo.Branch() != DefaultBranch {
+		t.Errorf("HEAD is %s on %q, want %s on %s", repo.head, repo.Branch(), picked.Hash, DefaultBranch)
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "one\n2\nthree\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if !repo.IsTracked("b.txt") {
+		t.Errorf("b.txt is not tracked")
+	}
+
+	result, err = repo.CherryPick([]string{side.Hash})
+	if err != nil || len(result.Commits) != 0 || len(result.Empty) != 1 {
+		t.Errorf("picking the same changes again = %+v, %v", result, err)
+	}
+}
+
+func TestCherryPickConflict(t *testing.T) {
+	repo, side := newPickRepository(t, "3\nfour\n")
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\n3\nFOUR\n")
+	mustAdd(t, repo, "a.txt")
+	mustCommit(t, repo, "fourth line")
+	head := repo.head
+
+	result, err := repo.CherryPick([]string{side.Hash})
+	if err != nil || result.Stopped == nil || !reflect.DeepEqual(result.Conflicts, []string{"a.txt"}) {
+		t.Fatalf("CherryPick() = %+v, %v", result, err)
+	}
+	want := "one\n2\n3\n<<<<<<< HEAD\nFOUR\n=======\nfour\n>>>>>>> " + side.Hash + " (last line)\n"
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != want {
+		t.Errorf("a.txt = %q, want %q", got, want)
+	}
+	if _, err = repo.CherryPick([]string{side.Hash}); err == nil {
+		t.Errorf("CherryPick() during a cherry-pick succeeded")
+	}
+	if _, err = repo.CherryPickContinue(); !errors.Is(err, ErrConflict) {
+		t.Errorf("CherryPickContinue() with the conflict unstaged = %v", err)
+	}
+	mustAdd(t, repo, "a.txt")
+	if _, err = repo.CherryPickContinue(); err == nil || !strings.Contains(err.Error(), "markers") {
+		t.Errorf("CherryPickContinue() with conflict markers = %v", err)
+	}
+
+	commit, err := repo.CherryPickAbort()
+	if err != nil || commit.Hash != head || repo.head != head {
+		t.Fatalf("CherryPickAbort() = %v, %v", commit, err)
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "one\n2\n3\nFOUR\n" || repo.IsTracked("b.txt") {
+		t.Errorf("after the abort a.txt = %q, b.txt tracked = %v", got, repo.IsTracked("b.txt"))
+	}
+
+	if _, err = repo.CherryPick([]string{side.Hash}); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\n3\nfour\n")
+	mustAdd(t, repo, "a.txt")
+	result, err = repo.CherryPickContinue()
+	if err != nil || len(result.Commits) != 1 || result.Commits[0].Author != "Bob" {
+		t.Fatalf("CherryPickContinue() = %+v, %v", result, err)
+	}
+	if _, err = repo.CherryPickContinue(); err == nil {
+		t.Errorf("CherryPickContinue() once done succeeded")
+	}
+}
+
+func TestCherryPickLocalChanges(t *testing.T) {
+	repo, side := newPickRepository(t, "three\n")
+	writeFile(t, repo.WorkTree(), "a.txt", "changed\n")
+	if _, err := repo.CherryPick([]string{side.Hash}); !errors.Is(err, ErrConflict) {
+		t.Errorf("CherryPick() with local changes = %v", err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\n3\n")
+	writeFile(t, repo.WorkTree(), "b.txt", "untracked\n")
+	if _, err := repo.CherryPick([]string{side.Hash}); !errors.Is(err, ErrConflict) {
+		t.Errorf("CherryPick() over an untracked file = %v", err)
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "one\n2\n3\n" {
+		t.Errorf("a failed CherryPick() changed a.txt to %q", got)
+	}
+}
@@ -0,0 +1,345 @@
+package svcs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	userConfigFilename = ".svcsconfig"
+	systemConfigPath   = "/etc/svcsconfig"
+)
+
+// Config scopes, from the lowest to the highest precedence.
+const (
+	ScopeSystem = iota
+	ScopeUser
+	ScopeRepository
+)
+
+// ScopeNames names the scopes, indexed by scope.
+var ScopeNames = []string{"system", "user", "repository"}
+
+// Value types understood by Config.GetTyped and `config --type`.
+const (
+	TypeString = "string"
+	TypeBool   = "bool"
+	TypeInt    = "int"
+	TypePath   = "path"
+)
+
+// Well-known configuration keys and the type of their values.
+var configKeys = map[string]string{
+	"user.name":               TypeString,
+	"user.email":              TypeString,
+	"init.defaultBranch":      TypeString,
+	"core.editor":             TypePath,
+	"core.largeFileThreshold": TypeInt,
+	"core.largeFilePatterns":  TypeString,
+	"gc.pruneExpire":          TypeString,
+}
+
+const aliasPrefix = "alias."
+
+// ConfigFile is the configuration of one scope, stored as the file Name of FS.
+type ConfigFile struct {
+	FS     FS
+	Name   string
+	Values map[string]string
+}
+
+// Config is the layered configuration: a file for each scope, indexed by
+// scope, the later ones overriding the earlier ones.
+type Config struct {
+	Files []*ConfigFile
+}
+
+// LoadConfig reads the system and user configuration files together with
+// the repository one in store, the vcs directory, which may be nil.
+func LoadConfig(store FS) (*Config, error) {
+	config := &Config{Files: make([]*ConfigFile, len(ScopeNames))}
+	for scope := range ScopeNames {
+		fsys, name := store, configFilename
+		if scope != ScopeRepository {
+			path := globalConfigPath(scope)
+			fsys, name = nil, ""
+			if path != "" {
+				fsys, name = NewOSFS(filepath.Dir(path)), filepath.Base(path)
+			}
+		}
+		file, err := ReadConfigFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		config.Files[scope] = file
+	}
+	return config, nil
+}
+
+func globalConfigPath(scope int) string {
+	if scope == ScopeSystem {
+		if path := os.Getenv("SVCS_CONFIG_SYSTEM"); path != "" {
+			return path
+		}
+		return systemConfigPath
+	}
+	if path := os.Getenv("SVCS_CONFIG_GLOBAL"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, userConfigFilename)
+}
+
+// ReadConfigFile reads the file name of fsys; a nil fsys gives an empty configuration that cannot be written.
+func ReadConfigFile(fsys FS, name string) (*ConfigFile, error) {
+	file := &ConfigFile{FS: fsys, Name: name, Values: map[string]string{}}
+	if fsys == nil {
+		return file, nil
+	}
+	data, err := fsys.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, ioError(err)
+	}
+	if len(data) == 0 {
+		return file, nil
+	}
+	if err = json.Unmarshal(data, &file.Values); err != nil {
+		return nil, corruptError(name, "%v", err)
+	}
+	if file.Values == nil {
+		file.Values = map[string]string{}
+	}
+	// Repositories created before scoped configuration stored the username as "name"
+	if name, ok := file.Values["name"]; ok {
+		delete(file.Values, "name")
+		if _, ok := file.Values["user.name"]; !ok {
+			file.Values["user.name"] = name
+		}
+	}
+	for key := range file.Values {
+		if err = ValidateKey(key); err != nil {
+			return nil, corruptError(name, "%v", err)
+		}
+	}
+	return file, nil
+}
+
+// Write saves the values of file, which must have been read from an FS.
+func (file *ConfigFile) Write() error {
+	if file.FS == nil {
+		return errors.New("no path for configuration file")
+	}
+	data, err := json.Marshal(file.Values)
+	if err != nil {
+		return err
+	}
+	return ioError(file.FS.WriteFile(file.Name, data))
+}
+
+// Get returns the value of key from the scope with the highest precedence that defines it.
+func (config *Config) Get(key string) (string, bool) {
+	for scope := len(config.Files) - 1; scope >= 0; scope-- {
+		if value, ok := config.Files[scope].Values[key]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// GetString returns the value of key, or "" if no scope defines it.
+func (config *Config) GetString(key string) string {
+	value, _ := config.Get(key)
+	return value
+}
+
+// GetBool returns the value of key parsed by ParseBool, or false if no scope
+// defines it.
+func (config *Config) GetBool(key string) (bool, error) {
+	value, ok := config.Get(key)
+	if !ok {
+		return false, nil
+	}
+	return ParseBool(value)
+}
+
+// GetInt returns the value of key parsed by ParseInt, or 0 if no scope
+// defines it.
+func (config *Config) GetInt(key string) (int, error) {
+	value, ok := config.Get(key)
+	if !ok {
+		return 0, nil
+	}
+	return ParseInt(value)
+}
+
+// GetPath returns the value of key expanded by ExpandPath, or "" if no scope
+// defines it.
+func (config *Config) GetPath(key string) (string, error) {
+	value, ok := config.Get(key)
+	if !ok {
+		return "", nil
+	}
+	return ExpandPath(value)
+}
+
+// GetTyped returns the value of key normalized according to valueType.
+func (config *Config) GetTyped(key, valueType string) (string, bool, error) {
+	value, ok := config.Get(key)
+	if !ok {
+		return "", false, nil
+	}
+	value, err := NormalizeValue(value, valueType)
+	return value, true, err
+}
+
+// Set sets key to value in scope and writes its file. Values of the
+// well-known keys must be of their type.
+func (config *Config) Set(scope int, key, value string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	if valueType, ok := configKeys[key]; ok {
+		if _, err := NormalizeValue(value, valueType); err != nil {
+			return err
+		}
+	}
+	file := config.Files[scope]
+	file.Values[key] = value
+	return file.Write()
+}
+
+// Unset removes key from scope, which must define it, and writes its file.
+func (config *Config) Unset(scope int, key string) error {
+	file := config.Files[scope]
+	if _, ok := file.Values[key]; !ok {
+		return fmt.Errorf("key '%s' is not set in %s configuration", key, ScopeNames[scope])
+	}
+	delete(file.Values, key)
+	return file.Write()
+}
+
+// List returns the effective "key=value" pairs sorted by key.
+func (config *Config) List() []string {
+	values := map[string]string{}
+	for _, file := range config.Files {
+		for key, value := range file.Values {
+			values[key] = value
+		}
+	}
+	return sortedPairs(values)
+}
+
+// List returns the "key=value" pairs of file sorted by key.
+func (file *ConfigFile) List() []string {
+	return sortedPairs(file.Values)
+}
+
+func sortedPairs(values map[string]string) []string {
+	pairs := make([]string, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// ValidateKey checks that key has the form "section.name", without spaces or "=".
+func ValidateKey(key string) error {
+	dot := strings.Index(key, ".")
+	if dot <= 0 || dot == len(key)-1 || strings.ContainsAny(key, " \t\n=") {
+		return fmt.Errorf("invalid key '%s', expected 'section.name'", key)
+	}
+	return nil
+}
+
+// NormalizeValue checks that value is of valueType, one of the Type
+// constants or "" for a string, and returns it in canonical form.
+func NormalizeValue(value, valueType string) (string, error) {
+	switch valueType {
+	case TypeString, "":
+		return value, nil
+	case TypeBool:
+		b, err := ParseBool(value)
+		return strconv.FormatBool(b), err
+	case TypeInt:
+		i, err := ParseInt(value)
+		return strconv.Itoa(i), err
+	case TypePath:
+		return ExpandPath(value)
+	}
+	return "", fmt.Errorf("unknown type '%s'", valueType)
+}
+
+// ParseBool accepts true, yes, on and 1, and false, no, off, 0 and "", in any case.
+func ParseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("bad boolean value '%s'", value)
+}
+
+// ParseInt accepts an optional k, m or g suffix.
+func ParseInt(value string) (int, error) {
+	multiplier := 1
+	switch strings.ToLower(value[len(value)-min(len(value), 1):]) {
+	case "k":
+		multiplier = 1 << 10
+	case "m":
+		multiplier = 1 << 20
+	case "g":
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad numeric value '%s'", value)
+	}
+	return i * multiplier, nil
+}
+
+// ExpandPath replaces a leading "~" with the home directory.
+func ExpandPath(value string) (string, error) {
+	if value != "~" && !strings.HasPrefix(value, "~/") {
+		return value, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, value[1:]), nil
+}
+
+// Aliases returns the defined aliases keyed by name.
+func (config *Config) Aliases() map[string]string {
+	aliases := map[string]string{}
+	for _, pair := range config.List() {
+		key, value, _ := strings.Cut(pair, "=")
+		if strings.HasPrefix(key, aliasPrefix) {
+			aliases[strings.TrimPrefix(key, aliasPrefix)] = value
+		}
+	}
+	return aliases
+}
+
+// Alias returns the definition of the alias name.
+func (config *Config) Alias(name string) (string, bool) {
+	return config.Get(aliasPrefix + name)
+}
@@ -0,0 +1,165 @@
+package svcs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setGlobalConfig points the system and user scopes at files holding the given JSON.
+func setGlobalConfig(t *testing.T, system, user string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, file := range []struct{ env, name, data string }{
+		{"SVCS_CONFIG_SYSTEM", "system", system},
+		{"SVCS_CONFIG_GLOBAL", "user", user},
+	} {
+		name := filepath.Join(dir, file.name)
+		if err := os.WriteFile(name, []byte(file.data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(file.env, name)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	setGlobalConfig(t,
+		`{"user.name":"System","core.pager":"less","alias.st":"status"}`,
+		`{"user.name":"User","user.email":"user@example.com"}`)
+	store := NewMemFS()
+	writeFile(t, store, configFilename, `{"user.email":"repo@example.com"}`)
+	config, err := LoadConfig(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"user.name":  "User",
+		"user.email": "repo@example.com",
+		"core.pager": "less",
+	} {
+		if got := config.GetString(key); got != want {
+			t.Errorf("GetString(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if _, ok := config.Get("user.missing"); ok {
+		t.Error("Get of an unset key reported it as set")
+	}
+	want := []string{"alias.st=status", "core.pager=less", "user.email=repo@example.com", "user.name=User"}
+	if got := config.List(); !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v", got, want)
+	}
+	if got := config.Aliases(); !reflect.DeepEqual(got, map[string]string{"st": "status"}) {
+		t.Errorf("Aliases() = %v", got)
+	}
+
+	if err = config.Set(ScopeRepository, "user.name", "Repo"); err != nil {
+		t.Fatal(err)
+	}
+	if err = config.Unset(ScopeRepository, "user.email"); err != nil {
+		t.Fatal(err)
+	}
+	if err = config.Unset(ScopeRepository, "user.email"); err == nil {
+		t.Error("Unset of a key that is not set succeeded")
+	}
+	reloaded, err := LoadConfig(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.GetString("user.name") != "Repo" || reloaded.GetString("user.email") != "user@example.com" {
+		t.Errorf("after Set and Unset: %v", reloaded.List())
+	}
+}
+
+func TestConfigSetValidates(t *testing.T) {
+	setGlobalConfig(t, "", "")
+	config, err := LoadConfig(NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"name", ".name", "user.", "user name.x", "a.b=c"} {
+		if err := config.Set(ScopeRepository, key, "x"); err == nil {
+			t.Errorf("Set(%q) succeeded", key)
+		}
+	}
+	if err := config.Set(ScopeRepository, "color.ui", "maybe"); err != nil {
+		t.Errorf("Set of an unknown key: %v", err)
+	}
+}
+
+func TestLegacyConfig(t *testing.T) {
+	store := NewMemFS()
+	writeFile(t, store, configFilename, `{"name":"Old"}`)
+	file, err := ReadConfigFile(store, configFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(file.Values, map[string]string{"user.name": "Old"}) {
+		t.Errorf("legacy configuration read as %v", file.Values)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		value, valueType string
+		want             string
+		wantErr          bool
+	}{
+		{"anything", TypeString, "anything", false},
+		{"yes", TypeBool, "true", false},
+		{"Off", TypeBool, "false", false},
+		{"", TypeBool, "false", false},
+		{"2", TypeBool, "", true},
+		{"42", TypeInt, "42", false},
+		{"-3", TypeInt, "-3", false},
+		{"2k", TypeInt, "2048", false},
+		{"1M", TypeInt, "1048576", false},
+		{"1g", TypeInt, "1073741824", false},
+		{"", TypeInt, "", true},
+		{"k", TypeInt, "", true},
+		{"1.5", TypeInt, "", true},
+		{"~/bin", TypePath, filepath.Join(home, "bin"), false},
+		{"~user/bin", TypePath, "~user/bin", false},
+		{"/usr/bin", TypePath, "/usr/bin", false},
+		{"x", "color", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeValue(tt.value, tt.valueType)
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("NormalizeValue(%q, %q) = %q, %v, want %q", tt.value, tt.valueType, got, err, tt.want)
+		}
+	}
+}
+
+func FuzzReadConfigFile(f *testing.F) {
+	f.Add([]byte(`{"user.name":"Ann","alias.st":"status --porcelain"}`))
+	f.Add([]byte(`{"name":"Old"}`))
+	f.Add([]byte(`[]`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		store := NewMemFS()
+		if err := store.WriteFile(configFilename, data); err != nil {
+			t.Fatal(err)
+		}
+		file, err := ReadConfigFile(store, configFilename)
+		if err != nil {
+			return
+		}
+		if err = file.Write(); err != nil {
+			t.Fatal(err)
+		}
+		again, err := ReadConfigFile(store, configFilename)
+		if err != nil {
+			t.Fatalf("reading a rewritten configuration: %v", err)
+		}
+		if !reflect.DeepEqual(again.Values, file.Values) {
+			t.Fatalf("round trip turned %v into %v", file.Values, again.Values)
+		}
+		if _, ok := file.Values["name"]; ok {
+			t.Fatalf("legacy key survived in %v", file.Values)
+		}
+	})
+}
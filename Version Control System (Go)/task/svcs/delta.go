@@ -0,0 +1,111 @@
+package svcs
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A delta rebuilds a target from a base: the sizes of both as uvarints,
+// then a series of instructions, each a deltaCopy byte followed by the
+// offset and length in the base of the data to copy, or a deltaInsert
+// byte followed by a length and that many bytes to insert.
+const (
+	deltaCopy   = 0
+	deltaInsert = 1
+	// deltaBlock is the size of the base blocks that makeDelta looks for in the target.
+	deltaBlock = 16
+	// maxDeltaValue bounds the sizes and offsets read from a delta.
+	maxDeltaValue = 1 << 40
+)
+
+var errBadDelta = errors.New("bad delta")
+
+// makeDelta returns a delta that rebuilds target from base.
+func makeDelta(base, target []byte) []byte {
+	index := map[string]int{}
+	for i := 0; i+deltaBlock <= len(base); i += deltaBlock {
+		if _, ok := index[string(base[i:i+deltaBlock])]; !ok {
+			index[string(base[i:i+deltaBlock])] = i
+		}
+	}
+	delta := binary.AppendUvarint(nil, uint64(len(base)))
+	delta = binary.AppendUvarint(delta, uint64(len(target)))
+	insert := func(data []byte) {
+		if len(data) > 0 {
+			delta = append(delta, deltaInsert)
+			delta = binary.AppendUvarint(delta, uint64(len(data)))
+			delta = append(delta, data...)
+		}
+	}
+	start := 0
+	for i := 0; i+deltaBlock <= len(target); {
+		offset, ok := index[string(target[i:i+deltaBlock])]
+		if !ok {
+			i++
+			continue
+		}
+		n := deltaBlock
+		for offset+n < len(base) && i+n < len(target) && base[offset+n] == target[i+n] {
+			n++
+		}
+		// Take back what matches from the data to insert
+		for offset > 0 && i > start && base[offset-1] == target[i-1] {
+			offset, i, n = offset-1, i-1, n+1
+		}
+		insert(target[start:i])
+		delta = append(delta, deltaCopy)
+		delta = binary.AppendUvarint(delta, uint64(offset))
+		delta = binary.AppendUvarint(delta, uint64(n))
+		i += n
+		start = i
+	}
+	insert(target[start:])
+	return delta
+}
+
+// applyDelta rebuilds the target of delta from base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	next := func() (int, bool) {
+		value, n := binary.Uvarint(delta)
+		if n <= 0 || value > maxDeltaValue {
+			return 0, false
+		}
+		delta = delta[n:]
+		return int(value), true
+	}
+	baseSize, ok1 := next()
+	targetSize, ok2 := next()
+	if !ok1 || !ok2 || baseSize != len(base) {
+		return nil, errBadDelta
+	}
+	target := make([]byte, 0, min(targetSize, len(base)+len(delta)))
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch op {
+		case deltaCopy:
+			offset, ok1 := next()
+			n, ok2 := next()
+			if !ok1 || !ok2 || offset+n > len(base) {
+				return nil, errBadDelta
+			}
+			target = append(target, base[offset:offset+n]...)
+		case deltaInsert:
+			n, ok := next()
+			if !ok || n > len(delta) {
+				return nil, errBadDelta
+			}
+			target = append(target, delta[:n]...)
+			delta = delta[n:]
+		default:
+			return nil, errBadDelta
+		}
+		if len(target) > targetSize {
+			return nil, errBadDelta
+		}
+	}
+	if len(target) != targetSize {
+		return nil, errBadDelta
+	}
+	return target, nil
+}
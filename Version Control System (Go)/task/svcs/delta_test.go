@@ -0,0 +1,74 @@
+package svcs
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	lines := func(from, to int) string {
+		var b strings.Builder
+		for i := from; i < to; i++ {
+			b.WriteString(strings.Repeat("line ", i%7) + "\n")
+		}
+		return b.String()
+	}
+	tests := []struct {
+		name, base, target string
+		// maxSize bounds the size of the delta, 0 for no bound
+		maxSize int
+	}{
+		{"empty", "", "", 0},
+		{"from nothing", "", "new", 0},
+		{"to nothing", "old", "", 0},
+		{"same", lines(0, 100), lines(0, 100), 10},
+		{"appended", lines(0, 100), lines(0, 100) + "more\n", 20},
+		{"inserted", lines(0, 100), lines(0, 50) + "more\n" + lines(50, 100), 40},
+		{"removed", lines(0, 100), lines(0, 20) + lines(60, 100), 30},
+		{"repeated", "0123456789abcdef", strings.Repeat("0123456789abcdef", 50), 0},
+		{"unrelated", lines(0, 10), strings.Repeat("x", 200), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := makeDelta([]byte(tt.base), []byte(tt.target))
+			if tt.maxSize > 0 && len(delta) > tt.maxSize {
+				t.Errorf("delta of %d bytes, want at most %d", len(delta), tt.maxSize)
+			}
+			got, err := applyDelta([]byte(tt.base), delta)
+			if err != nil || string(got) != tt.target {
+				t.Errorf("applyDelta() = %q, %v, want %q", got, err, tt.target)
+			}
+		})
+	}
+}
+
+func TestApplyBadDelta(t *testing.T) {
+	base := []byte("0123456789abcdef")
+	good := makeDelta(base, []byte("89abcdef01234567"))
+	for _, delta := range [][]byte{
+		nil,
+		makeDelta([]byte("other base"), base),
+		good[:len(good)-1],
+		append(append([]byte{}, good...), deltaInsert, 1, 'x'),
+		{16, 1, deltaCopy, 10, 10},
+		{16, 1, 7},
+	} {
+		if got, err := applyDelta(base, delta); err == nil {
+			t.Errorf("applyDelta(%v) = %q, want an error", delta, got)
+		}
+	}
+}
+
+func FuzzDelta(f *testing.F) {
+	f.Add([]byte("0123456789abcdef0123456789abcdef"), []byte("0123456789abcdefXY0123456789abcdef"))
+	f.Add([]byte{}, []byte("x"))
+	f.Fuzz(func(t *testing.T, base, target []byte) {
+		got, err := applyDelta(base, makeDelta(base, target))
+		if err != nil || !bytes.Equal(got, target) {
+			t.Fatalf("round trip = %q, %v, want %q", got, err, target)
+		}
+		// Any data must be rejected or applied without panicking
+		applyDelta(base, target)
+	})
+}
@@ -0,0 +1,344 @@
+package svcs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// DefaultContext is the number of unchanged lines shown around each change.
+const DefaultContext = 3
+
+type Op int
+
+const (
+	OpEqual Op = iota
+	OpDelete
+	OpInsert
+)
+
+// Edit is one step of turning the old lines into the new ones. OldLine and
+// NewLine are the 0-based positions in the old and new lines at which it applies.
+type Edit struct {
+	Op      Op
+	OldLine int
+	NewLine int
+	Text    string
+}
+
+// SplitLines splits data after each newline; the last line may lack one.
+func SplitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		lines = append(lines, string(data[:end]))
+		data = data[end:]
+	}
+	return lines
+}
+
+// DiffLines returns a shortest edit script from a to b, using Myers' algorithm.
+func DiffLines(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	x, y := 0, 0
+search:
+	for d := 0; d <= n+m; d++ {
+		// Only diagonals -d-1..d+1 are read while taking step d
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	var edits []Edit
+	x, y = n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k] < v[d+k+2]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+1+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, Edit{OpEqual, x, y, a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			edits = append(edits, Edit{OpInsert, prevX, prevY, b[prevY]})
+		} else {
+			edits = append(edits, Edit{OpDelete, prevX, prevY, a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+// IsBinary reports whether data looks like a binary file.
+func IsBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// UnifiedDiff formats the changes from a to b as a unified diff with the
+// given number of context lines. It returns "" if the contents are equal.
+func UnifiedDiff(oldName, newName string, a, b []byte, context int) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	if IsBinary(a) || IsBinary(b) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	edits := DiffLines(SplitLines(a), SplitLines(b))
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(edits); {
+		if edits[i].Op == OpEqual {
+			i++
+			continue
+		}
+		start := max(i-context, 0)
+		end := i
+		for {
+			for end < len(edits) && edits[end].Op != OpEqual {
+				end++
+			}
+			run := 0
+			for end+run < len(edits) && edits[end+run].Op == OpEqual {
+				run++
+			}
+			if end+run < len(edits) && run <= 2*context {
+				end += run
+				continue
+			}
+			end += min(run, context)
+			break
+		}
+		writeHunk(&out, edits[start:end])
+		i = end
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, edits []Edit) {
+	oldCount, newCount := 0, 0
+	for _, edit := range edits {
+		if edit.Op != OpInsert {
+			oldCount++
+		}
+		if edit.Op != OpDelete {
+			newCount++
+		}
+	}
+	oldStart, newStart := edits[0].OldLine, edits[0].NewLine
+	if oldCount > 0 {
+		oldStart++
+	}
+	if newCount > 0 {
+		newStart++
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, edit := range edits {
+		out.WriteString([]string{" ", "-", "+"}[edit.Op])
+		out.WriteString(edit.Text)
+		if !strings.HasSuffix(edit.Text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// FileDiff is the change to one tracked file.
+type FileDiff struct {
+	Path  string `json:"path"`
+	State string `json:"state"`
+	Patch string `json:"patch"`
+}
+
+// Diff compares the tracked files in the work tree with their contents as of
+// the revision rev, or the latest commit if rev is empty. Unchanged files are omitted.
+func (repo *Repository) Diff(rev string) ([]FileDiff, error) {
+	if rev == "" && repo.head != "" {
+		rev = Head
+	}
+	var commit *Commit
+	if rev != "" {
+		var err error
+		if commit, err = repo.ResolveRevision(rev); err != nil {
+			return nil, err
+		}
+	}
+	committed, err := repo.treeOf(commit)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, snap := range []snapshot{repo.index, committed} {
+		for _, entry := range snap.Files {
+			names = append(names, entry.Path)
+		}
+	}
+	sort.Strings(names)
+	var diffs []FileDiff
+	for i, fn := range names {
+		if i > 0 && names[i-1] == fn {
+			continue
+		}
+		var old, current []byte
+		var info fs.FileInfo
+		oldName, newName := "a/"+fn, "b/"+fn
+		// Large files are compared by id and their contents left unread
+		oldID, newID, large := committed.lookup(fn), "", false
+		if oldID == "" {
+			oldName = "/dev/null"
+		} else {
+			var kind string
+			if kind, old, err = repo.readFile(oldID); err != nil {
+				return nil, err
+			}
+			large = kind == ObjectPointer
+		}
+		if repo.IsTracked(fn) {
+			info, err = repo.work.Stat(fn)
+		}
+		if !repo.IsTracked(fn) || errors.Is(err, fs.ErrNotExist) {
+			newName, err = "/dev/null", nil
+		}
+		if err != nil {
+			return nil, ioError(err)
+		}
+		if newName != "/dev/null" {
+			isLarge, err := repo.isLarge(fn, info.Size())
+			if err != nil {
+				return nil, err
+			}
+			if large = large || isLarge; large {
+				newID, err = repo.fileID(fn, info.Size())
+			} else if current, err = repo.work.ReadFile(fn); err != nil {
+				err = ioError(err)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		state := StateModified
+		switch {
+		case oldName == "/dev/null" && newName == "/dev/null":
+			continue
+		case oldName == "/dev/null":
+			state = StateAdded
+		case newName == "/dev/null":
+			state = StateDeleted
+		case large && oldID == newID, !large && bytes.Equal(old, current):
+			continue
+		}
+		patch := UnifiedDiff(oldName, newName, old, current, DefaultContext)
+		if large {
+			patch = fmt.Sprintf("Large files %s and %s differ\n", oldName, newName)
+		}
+		diffs = append(diffs, FileDiff{fn, state, patch})
+	}
+	return diffs, nil
+}
+
+// Changes returns the changes that commit made to the files of its first
+// parent, or of an empty tree if it has none.
+func (repo *Repository) Changes(commit *Commit) ([]FileDiff, error) {
+	var parent *Commit
+	if len(commit.Parents) > 0 {
+		var err error
+		if parent, err = repo.ReadCommit(commit.Parents[0]); err != nil {
+			return nil, err
+		}
+	}
+	old, err := repo.treeOf(parent)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := repo.readTree(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	return repo.diffSnapshots(old, snap)
+}
+
+// diffSnapshots compares the files of the snapshots old and snap. Unchanged
+// files are omitted.
+func (repo *Repository) diffSnapshots(old, snap snapshot) ([]FileDiff, error) {
+	var names []string
+	for _, s := range []snapshot{old, snap} {
+		for _, entry := range s.Files {
+			names = append(names, entry.Path)
+		}
+	}
+	sort.Strings(names)
+	var diffs []FileDiff
+	for i, fn := range names {
+		oldID, newID := old.lookup(fn), snap.lookup(fn)
+		if (i > 0 && names[i-1] == fn) || oldID == newID {
+			continue
+		}
+		oldName, newName, state := "a/"+fn, "b/"+fn, StateModified
+		switch {
+		case oldID == "":
+			oldName, state = "/dev/null", StateAdded
+		case newID == "":
+			newName, state = "/dev/null", StateDeleted
+		}
+		var contents [2][]byte
+		large := false
+		for side, id := range []string{oldID, newID} {
+			if id == "" {
+				continue
+			}
+			kind, data, err := repo.readFile(id)
+			if err != nil {
+				return nil, err
+			}
+			contents[side], large = data, large || kind == ObjectPointer
+		}
+		patch := UnifiedDiff(oldName, newName, contents[0], contents[1], DefaultContext)
+		if large {
+			patch = fmt.Sprintf("Large files %s and %s differ\n", oldName, newName)
+		}
+		diffs = append(diffs, FileDiff{fn, state, patch})
+	}
+	return diffs, nil
+}
@@ -0,0 +1,134 @@
+package svcs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"change", "a\nb\nc\n", "a\nB\nc\n",
+			"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"created", "", "a\n",
+			"--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			"emptied", "a\nb\n", "",
+			"--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			"missing newline", "a\nb", "a\nb\n",
+			"--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n",
+			"--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			"merged hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"one\n2\n3\n4\n5\n6\n7\neight\n",
+			"--- old\n+++ new\n@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{"binary", "a\x00", "b\x00", "Binary files old and new differ\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff("old", "new", []byte(tt.a), []byte(tt.b), DefaultContext)
+			if got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// checkEdits verifies that edits turn a into b and returns the number of changed lines.
+func checkEdits(t *testing.T, a, b []string, edits []Edit) int {
+	t.Helper()
+	var old, new []string
+	changes := 0
+	for _, edit := range edits {
+		if edit.Op != OpInsert {
+			if edit.OldLine != len(old) {
+				t.Fatalf("edit %+v at old line %d", edit, len(old))
+			}
+			old = append(old, edit.Text)
+		}
+		if edit.Op != OpDelete {
+			if edit.NewLine != len(new) {
+				t.Fatalf("edit %+v at new line %d", edit, len(new))
+			}
+			new = append(new, edit.Text)
+		}
+		if edit.Op != OpEqual {
+			changes++
+		}
+	}
+	if strings.Join(old, "") != strings.Join(a, "") || strings.Join(new, "") != strings.Join(b, "") {
+		t.Fatalf("edits %+v do not turn %q into %q", edits, a, b)
+	}
+	return changes
+}
+
+func TestDiffLinesIsShortest(t *testing.T) {
+	a := strings.Split("a b c a b b a", " ")
+	b := strings.Split("c b a b a c", " ")
+	// The example of Myers' paper, with an edit distance of 5
+	if changes := checkEdits(t, a, b, DiffLines(a, b)); changes != 5 {
+		t.Errorf("DiffLines() made %d changes, want 5", changes)
+	}
+}
+
+func FuzzDiffLines(f *testing.F) {
+	f.Add([]byte("a\nb\nc\n"), []byte("a\nc\nd\n"))
+	f.Add([]byte(""), []byte("x"))
+	f.Fuzz(func(t *testing.T, a, b []byte) {
+		oldLines, newLines := SplitLines(a), SplitLines(b)
+		changes := checkEdits(t, oldLines, newLines, DiffLines(oldLines, newLines))
+		if changes > len(oldLines)+len(newLines) {
+			t.Fatalf("%d changes for %d lines", changes, len(oldLines)+len(newLines))
+		}
+	})
+}
+
+func TestChanges(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n")
+	writeFile(t, repo.WorkTree(), "b.txt", "b\n")
+	mustAdd(t, repo, "a.txt", "b.txt")
+	first := mustCommit(t, repo, "first")
+	if diffs, err := repo.Changes(first); err != nil || len(diffs) != 2 || diffs[0].State != StateAdded || diffs[1].State != StateAdded {
+		t.Errorf("Changes() of the first commit = %+v, %v", diffs, err)
+	}
+
+	writeFile(t, repo.WorkTree(), "a.txt", "two\n")
+	writeFile(t, repo.WorkTree(), "c.txt", "c\n")
+	if err := repo.WorkTree().Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, repo, "a.txt", "b.txt", "c.txt")
+	second := mustCommit(t, repo, "second")
+	diffs, err := repo.Changes(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileDiff{
+		{"a.txt", StateModified, "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-one\n+two\n"},
+		{"b.txt", StateDeleted, "--- a/b.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-b\n"},
+		{"c.txt", StateAdded, "--- /dev/null\n+++ b/c.txt\n@@ -0,0 +1 @@\n+c\n"},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("Changes() = %+v, want %+v", diffs, want)
+	}
+}
@@ -0,0 +1,56 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds; test for them with errors.Is.
+var (
+	ErrNotARepo        = errors.New("not a svcs repository")
+	ErrUnknownRevision = errors.New("unknown revision")
+	ErrNothingToCommit = errors.New("nothing to commit")
+	ErrConflict        = errors.New("conflict")
+	ErrIO              = errors.New("i/o failure")
+	ErrFormat          = errors.New("unsupported repository format")
+	ErrCorrupt         = errors.New("corrupt repository")
+)
+
+// Error is a failure of a given kind with a message for the user and an optional cause.
+type Error struct {
+	Kind    error
+	Message string
+	Err     error
+}
+
+func (err *Error) Error() string {
+	if err.Err == nil {
+		return err.Message
+	}
+	if err.Message == "" {
+		return err.Err.Error()
+	}
+	return err.Message + ": " + err.Err.Error()
+}
+
+func (err *Error) Unwrap() []error {
+	return []error{err.Kind, err.Err}
+}
+
+// NewError returns an Error of the given kind with a formatted message.
+func NewError(kind error, format string, a ...any) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// ioError wraps a filesystem error; it returns nil if err is nil.
+func ioError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: ErrIO, Err: err}
+}
+
+// corruptError reports that the vcs file name does not match its schema.
+func corruptError(name string, format string, a ...any) error {
+	return &Error{Kind: ErrCorrupt, Message: name + ": " + fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,285 @@
+package svcs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FormatVersion is the version of the repository format written by this package.
+//
+// Format 1 had no FORMAT file: log.txt listed the commits, each stored as a
+// copy of its files under commits/<hash>/, and index.txt named the tracked files.
+// Format 2 stores content-addressed objects compressed with zlib, loose or in
+// packs that may store them as deltas against similar ones, pointer objects
+// standing in trees for files kept whole in the large-object area under
+// large/, HEAD and branches under refs/heads, and an index holding the staged
+// snapshot.
+const FormatVersion = 2
+
+const (
+	formatFilename = "FORMAT"
+	v1CommitsDir   = "commits"
+	v1LogFilename  = "log.txt"
+)
+
+// readFormat returns the format version of the repository in store, or 0 if
+// there is no repository.
+func readFormat(store FS) (int, error) {
+	data, err := store.ReadFile(formatFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		if info, err := store.Stat(v1CommitsDir); err == nil && info.IsDir() {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	if err != nil {
+		return 0, ioError(err)
+	}
+	value, ok := strings.CutSuffix(string(data), "\n")
+	version, err := strconv.Atoi(value)
+	if !ok || err != nil || version < 1 {
+		return 0, corruptError(formatFilename, "bad format version '%s'", strings.TrimSpace(string(data)))
+	}
+	return version, nil
+}
+
+func writeFormat(store FS, version int) error {
+	return ioError(store.WriteFile(formatFilename, []byte(strconv.Itoa(version)+"\n")))
+}
+
+// checkFormat fails unless store holds a repository in the current format.
+func checkFormat(store FS) error {
+	version, err := readFormat(store)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version == 0:
+		return NewError(ErrNotARepo, "not a svcs repository")
+	case version < FormatVersion:
+		return NewError(ErrFormat, "the repository is in format %d; run 'svcs upgrade' to convert it to format %d", version, FormatVersion)
+	case version > FormatVersion:
+		return NewError(ErrFormat, "the repository is in format %d, but this version of svcs only supports format %d", version, FormatVersion)
+	}
+	return nil
+}
+
+// Renamed maps the id of a commit in the old format to its id after an upgrade.
+type Renamed struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// UpgradeResult describes what Upgrade did.
+type UpgradeResult struct {
+	From    int       `json:"from"`
+	To      int       `json:"to"`
+	Commits []Renamed `json:"commits"`
+}
+
+// Upgrade converts the repository of the work tree at root to the current format.
+func Upgrade(root string) (*UpgradeResult, error) {
+	return UpgradeFS(NewOSFS(root), NewOSFS(filepath.Join(root, Dir)))
+}
+
+// UpgradeFS converts the repository for the work tree work whose vcs directory
+// is store to the current format, keeping its whole history. Commit ids change
+// with the format; the result lists the old and new ones.
+func UpgradeFS(work, store FS) (*UpgradeResult, error) {
+	version, err := readFormat(store)
+	if err != nil {
+		return nil, err
+	}
+	result := &UpgradeResult{From: version, To: FormatVersion, Commits: []Renamed{}}
+	switch {
+	case version == 0:
+		return nil, NewError(ErrNotARepo, "not a svcs repository")
+	case version > FormatVersion:
+		return nil, checkFormat(store)
+	case version == FormatVersion:
+		return result, nil
+	}
+	// Format 1 is the only earlier one
+	if result.Commits, err = upgradeV1(work, store); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// v1Commit is an entry of log.txt in format 1.
+type v1Commit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Email   string `json:"email,omitempty"`
+	Message string `json:"message"`
+}
+
+// upgradeV1 rewrites a format 1 repository in the current format. The commits of
+// log.txt become a chain on the default branch, dated by their directories'
+// modification times unless SVCS_AUTHOR_DATE is set. Tracked files are staged as of the last commit, or as in
+// the work tree if they were never committed.
+func upgradeV1(work, store FS) ([]Renamed, error) {
+	var log struct {
+		Commits []v1Commit `json:"commits"`
+	}
+	if err := readV1File(store, v1LogFilename, &log); err != nil {
+		return nil, err
+	}
+	var index struct {
+		Files []string `json:"files"`
+	}
+	if err := readV1File(store, indexFilename, &index); err != nil {
+		return nil, err
+	}
+	// Rewrite the legacy "name" key as user.name
+	config, err := ReadConfigFile(store, configFilename)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Values) > 0 {
+		if err = config.Write(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Start over from any earlier, interrupted upgrade
+	if err = removeAll(store, "refs"); err != nil {
+		return nil, err
+	}
+	if err = createLayout(store); err != nil {
+		return nil, err
+	}
+	repo := &Repository{work: work, store: store}
+	if repo.Config, err = LoadConfig(store); err != nil {
+		return nil, err
+	}
+	if err = repo.readHead(); err != nil {
+		return nil, err
+	}
+	renamed := []Renamed{}
+	var last snapshot
+	for _, old := range log.Commits {
+		if !ValidID(old.Hash) {
+			return nil, corruptError(v1LogFilename, "bad commit id '%s'", old.Hash)
+		}
+		dir := path.Join(v1CommitsDir, old.Hash)
+		info, err := store.Stat(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, corruptError(v1LogFilename, "the files of commit %s are missing", old.Hash)
+		}
+		if err != nil {
+			return nil, ioError(err)
+		}
+		if last, err = repo.storeV1Files(dir); err != nil {
+			return nil, err
+		}
+		tree, err := repo.writeTree(last)
+		if err != nil {
+			return nil, err
+		}
+		date, err := commitDate(info.ModTime())
+		if err != nil {
+			return nil, err
+		}
+		commit := &Commit{
+			Tree:    tree,
+			Parents: []string{},
+			Author:  old.Author,
+			Email:   old.Email,
+			Date:    date,
+			Message: old.Message,
+		}
+		if repo.head != "" {
+			commit.Parents = []string{repo.head}
+		}
+		if err = repo.writeCommit(commit); err != nil {
+			return nil, err
+		}
+		if err = repo.moveHead(commit.Hash, "upgrade: "+commit.Subject()); err != nil {
+			return nil, err
+		}
+		renamed = append(renamed, Renamed{old.Hash, commit.Hash})
+	}
+
+	for _, name := range index.Files {
+		clean, err := CleanPath(name)
+		if err != nil || clean != name {
+			return nil, corruptError(indexFilename, "bad path '%s'", name)
+		}
+		blob := last.lookup(name)
+		if blob == "" {
+			info, err := work.Stat(name)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, ioError(err)
+			}
+			if blob, err = repo.writeBlob(name, info.Size()); err != nil {
+				return nil, err
+			}
+		}
+		repo.index.set(name, blob)
+	}
+	if err = repo.writeIndex(); err != nil {
+		return nil, err
+	}
+	if err = writeFormat(store, FormatVersion); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{v1LogFilename, v1CommitsDir} {
+		if err = removeAll(store, name); err != nil {
+			return nil, err
+		}
+	}
+	return renamed, nil
+}
+
+// readV1File decodes a JSON file of format 1, which may be missing or empty.
+func readV1File(store FS, name string, v any) error {
+	data, err := store.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return ioError(err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return corruptError(name, "%v", err)
+	}
+	return nil
+}
+
+// storeV1Files stores the files copied under dir as blobs and returns their snapshot.
+func (repo *Repository) storeV1Files(dir string) (snapshot, error) {
+	var snap snapshot
+	err := fs.WalkDir(repo.store, dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return ioError(err)
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		data, err := repo.store.ReadFile(name)
+		if err != nil {
+			return ioError(err)
+		}
+		blob, err := repo.writeObject(ObjectBlob, data)
+		if err != nil {
+			return err
+		}
+		snap.Files = append(snap.Files, TreeEntry{strings.TrimPrefix(name, dir+"/"), blob})
+		return nil
+	})
+	if err != nil {
+		return snap, err
+	}
+	sort.Slice(snap.Files, func(i, j int) bool { return snap.Files[i].Path < snap.Files[j].Path })
+	return snap, snap.validate(dir)
+}
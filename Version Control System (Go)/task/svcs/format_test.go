@@ -0,0 +1,149 @@
+package svcs
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+const (
+	v1First  = "11111111111111111111111111111111"
+	v1Second = "22222222222222222222222222222222"
+)
+
+// newV1Repository returns the work tree and vcs directory of a repository in
+// format 1 with two commits, as the first versions of svcs wrote them.
+func newV1Repository(t *testing.T) (FS, FS) {
+	t.Helper()
+	t.Setenv("SVCS_CONFIG_GLOBAL", "/nonexistent/svcsconfig")
+	t.Setenv("SVCS_CONFIG_SYSTEM", "/nonexistent/svcsconfig")
+	work, store := NewMemFS(), NewMemFS()
+	writeFile(t, work, "a.txt", "a2")
+	writeFile(t, work, "dir/b.txt", "b")
+	writeFile(t, work, "new.txt", "never committed")
+	writeFile(t, store, "config.txt", `{"name":"Ann"}`)
+	writeFile(t, store, "log.txt", `{"commits":[`+
+		`{"hash":"`+v1First+`","author":"Ann","message":"first"},`+
+		`{"hash":"`+v1Second+`","author":"Ann","email":"ann@example.com","message":"second"}]}`)
+	writeFile(t, store, "index.txt", `{"files":["a.txt","dir/b.txt","new.txt","gone.txt"]}`)
+	writeFile(t, store, "commits/"+v1First+"/a.txt", "a1")
+	writeFile(t, store, "commits/"+v1Second+"/a.txt", "a2")
+	writeFile(t, store, "commits/"+v1Second+"/dir/b.txt", "b")
+	return work, store
+}
+
+func TestOpenV1(t *testing.T) {
+	work, store := newV1Repository(t)
+	for _, open := range []func(FS, FS) (*Repository, error){OpenFS, InitFS} {
+		if _, err := open(work, store); !errors.Is(err, ErrFormat) {
+			t.Errorf("opening a format 1 repository: got %v, want ErrFormat", err)
+		}
+	}
+}
+
+func TestUpgradeV1(t *testing.T) {
+	work, store := newV1Repository(t)
+	result, err := UpgradeFS(work, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.From != 1 || result.To != FormatVersion || len(result.Commits) != 2 ||
+		result.Commits[0].Old != v1First || result.Commits[1].Old != v1Second {
+		t.Fatalf("UpgradeFS() = %+v", result)
+	}
+	repo, err := OpenFS(work, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := repo.Log(LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 2 || log[0].Hash != result.Commits[1].New || log[1].Hash != result.Commits[0].New {
+		t.Fatalf("Log() = %+v, want the upgraded commits", log)
+	}
+	second, first := log[0], log[1]
+	if second.Message != "second" || second.Email != "ann@example.com" || first.Author != "Ann" ||
+		!reflect.DeepEqual(second.Parents, []string{first.Hash}) || len(first.Parents) != 0 {
+		t.Errorf("upgraded commits: %+v", log)
+	}
+	if repo.Branch() != DefaultBranch || repo.Config.GetString("user.name") != "Ann" {
+		t.Errorf("branch %q, user.name %q", repo.Branch(), repo.Config.GetString("user.name"))
+	}
+	if got := repo.Tracked(); !reflect.DeepEqual(got, []string{"a.txt", "dir/b.txt", "new.txt"}) {
+		t.Errorf("Tracked() = %v", got)
+	}
+	statuses, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if new := statuses[2]; new.Path != "new.txt" || new.Staged != StateAdded || new.Unstaged != StateUnmodified {
+		t.Errorf("status of a file added but never committed: %+v", new)
+	}
+	for _, name := range []string{"log.txt", "commits"} {
+		if _, err := store.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s still exists after the upgrade: %v", name, err)
+		}
+	}
+
+	if _, err = repo.Checkout(first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, work, "a.txt"); got != "a1" {
+		t.Errorf("a.txt of the first commit = %q", got)
+	}
+	again, err := UpgradeFS(work, store)
+	if err != nil || again.From != FormatVersion || len(again.Commits) != 0 {
+		t.Errorf("upgrading twice: %+v, %v", again, err)
+	}
+}
+
+func TestUpgradeErrors(t *testing.T) {
+	if _, err := UpgradeFS(NewMemFS(), NewMemFS()); !errors.Is(err, ErrNotARepo) {
+		t.Errorf("upgrading nothing: got %v, want ErrNotARepo", err)
+	}
+	work, store := newV1Repository(t)
+	if err := store.Remove("commits/" + v1First + "/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remove("commits/" + v1First); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UpgradeFS(work, store); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("upgrading with a missing commit: got %v, want ErrCorrupt", err)
+	}
+	// The failed attempt leaves the old repository in place
+	writeFile(t, store, "commits/"+v1First+"/a.txt", "a1")
+	if _, err := UpgradeFS(work, store); err != nil {
+		t.Errorf("upgrading after fixing the repository: %v", err)
+	}
+	writeFile(t, store, "FORMAT", "9\n")
+	if _, err := UpgradeFS(work, store); !errors.Is(err, ErrFormat) {
+		t.Errorf("upgrading a newer format: got %v, want ErrFormat", err)
+	}
+}
+
+func FuzzUpgradeV1(f *testing.F) {
+	f.Add([]byte(`{"commits":[{"hash":"`+v1First+`","author":"Ann","message":"m"}]}`), []byte(`{"files":["a.txt"]}`))
+	f.Add([]byte(""), []byte(""))
+	f.Add([]byte(`{"commits":null}`), []byte(`{"files":[1]}`))
+	f.Fuzz(func(t *testing.T, logData, indexData []byte) {
+		work, store := newV1Repository(t)
+		writeFile(t, store, "log.txt", string(logData))
+		writeFile(t, store, "index.txt", string(indexData))
+		if _, err := UpgradeFS(work, store); err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("UpgradeFS() = %v, want ErrCorrupt", err)
+			}
+			return
+		}
+		repo, err := OpenFS(work, store)
+		if err != nil {
+			t.Fatalf("opening an upgraded repository: %v", err)
+		}
+		if _, err = repo.Log(LogOptions{}); err != nil {
+			t.Fatalf("Log() of an upgraded repository: %v", err)
+		}
+	})
+}
@@ -0,0 +1,120 @@
+package svcs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FS is a writable filesystem holding either a work tree or the contents of
+// a vcs directory. Names are slash-separated, unrooted paths as in io/fs.
+type FS interface {
+	fs.StatFS
+	fs.ReadDirFS
+	fs.ReadFileFS
+	// Create creates or truncates the file name; its directory must exist.
+	Create(name string) (io.WriteCloser, error)
+	WriteFile(name string, data []byte) error
+	// AppendFile adds data to the end of the file name, creating it if needed.
+	AppendFile(name string, data []byte) error
+	MkdirAll(name string) error
+	// Remove removes the file or empty directory name.
+	Remove(name string) error
+	Rename(oldname, newname string) error
+}
+
+// OSFS is the FS of the local directory tree rooted at Root.
+type OSFS struct {
+	Root string
+}
+
+func NewOSFS(root string) *OSFS {
+	return &OSFS{Root: root}
+}
+
+// osRoot returns the root of fsys if it is an OSFS, or "".
+func osRoot(fsys FS) string {
+	if osfs, ok := fsys.(*OSFS); ok {
+		return osfs.Root
+	}
+	return ""
+}
+
+func (fsys *OSFS) path(name string) string {
+	return filepath.Join(fsys.Root, filepath.FromSlash(name))
+}
+
+func (fsys *OSFS) Open(name string) (fs.File, error) {
+	return os.Open(fsys.path(name))
+}
+
+func (fsys *OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(fsys.path(name))
+}
+
+func (fsys *OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(fsys.path(name))
+}
+
+func (fsys *OSFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(fsys.path(name))
+}
+
+func (fsys *OSFS) Create(name string) (io.WriteCloser, error) {
+	return os.Create(fsys.path(name))
+}
+
+func (fsys *OSFS) WriteFile(name string, data []byte) error {
+	return os.WriteFile(fsys.path(name), data, os.ModePerm)
+}
+
+func (fsys *OSFS) AppendFile(name string, data []byte) error {
+	file, err := os.OpenFile(fsys.path(name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (fsys *OSFS) MkdirAll(name string) error {
+	return os.MkdirAll(fsys.path(name), os.ModePerm)
+}
+
+func (fsys *OSFS) Remove(name string) error {
+	return os.Remove(fsys.path(name))
+}
+
+func (fsys *OSFS) Rename(oldname, newname string) error {
+	return os.Rename(fsys.path(oldname), fsys.path(newname))
+}
+
+// removeAll removes name and everything below it; a missing name is not an error.
+func removeAll(fsys FS, name string) error {
+	var names []string
+	err := fs.WalkDir(fsys, name, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return ioError(err)
+	}
+	// Children come after their directory in walk order
+	for i := len(names) - 1; i >= 0; i-- {
+		if err = fsys.Remove(names[i]); err != nil {
+			return ioError(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FsckResult is the report of a repository check.
+type FsckResult struct {
+	// Objects is the number of objects checked.
+	Objects int `json:"objects"`
+	// Large is the number of files of the large-object area checked.
+	Large int `json:"large"`
+	// Problems describes each inconsistency found; there are none in a sound repository.
+	Problems []string `json:"problems"`
+	// Dangling lists the objects that HEAD, the refs, the reflogs and the index do not lead to.
+	Dangling []DanglingObject `json:"dangling"`
+}
+
+// DanglingObject is an object that nothing refers to. Its Type is
+// "large" for a file of the large-object area.
+type DanglingObject struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Fsck checks the repository of the work tree at root.
+func Fsck(root string) (*FsckResult, error) {
+	return FsckFS(NewOSFS(filepath.Join(root, Dir)))
+}
+
+// FsckFS checks the integrity of the vcs directory store: every object must
+// hash to its id and parse, every object that a commit, tree, ref or the index
+// refers to must exist with the right type, packs must match their indexes,
+// large files must hash to their id and match the size of their pointers,
+// and every other file must be valid. Problems are reported in the result;
+// only failures to read the repository are returned as errors.
+func FsckFS(store FS) (*FsckResult, error) {
+	if err := checkFormat(store); err != nil {
+		return nil, err
+	}
+	c := &checker{
+		repo:     &Repository{store: store},
+		result:   &FsckResult{Problems: []string{}, Dangling: []DanglingObject{}},
+		reported: map[string]bool{},
+		types:    map[string]string{},
+		links:    map[string][]string{},
+		pointers: map[string]pointerRef{},
+		large:    map[string]int64{},
+	}
+	if err := c.checkObjects(); err != nil {
+		return nil, err
+	}
+	if err := c.checkLargeFiles(); err != nil {
+		return nil, err
+	}
+	roots, err := c.checkRefs()
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range c.expected {
+		switch kind, ok := c.types[ref.id]; {
+		case kind == "" && ok:
+			// Unreadable, which is already reported
+		case !ok:
+			c.problem("%s: missing %s %s%s", ref.from, ref.kind, ref.id, ref.detail)
+		case ref.kind == ObjectBlob && kind == ObjectPointer:
+			// Files may be kept in the large-object area
+		case kind != ref.kind:
+			c.problem("%s: %s is a %s, not a %s%s", ref.from, ref.id, kind, ref.kind, ref.detail)
+		}
+	}
+	c.checkPointers()
+	c.findDangling(roots)
+	return c.result, nil
+}
+
+// checker holds the state of FsckFS.
+type checker struct {
+	repo     *Repository
+	result   *FsckResult
+	reported map[string]bool
+	// types maps the id of every object found to its type, or "" if it is unreadable
+	types map[string]string
+	// links maps the id of a tree or commit to the ids it refers to
+	links    map[string][]string
+	expected []expectedObject
+	// pointers maps the id of every pointer object to what it points to
+	pointers map[string]pointerRef
+	// large maps the id of every large file found to its size, or -1 if it is unreadable
+	large map[string]int64
+}
+
+// pointerRef is a pointer object read from the file name.
+type pointerRef struct {
+	name    string
+	pointer largePointer
+}
+
+// expectedObject is a reference from the file from to an object that must exist.
+type expectedObject struct {
+	from, id, kind, detail string
+}
+
+func (c *checker) problem(format string, a ...any) {
+	message := fmt.Sprintf(format, a...)
+	if !c.reported[message] {
+		c.reported[message] = true
+		c.result.Problems = append(c.result.Problems, message)
+	}
+}
+
+// report records err as a problem if it reports corruption and returns any other error.
+func (c *checker) report(err error) error {
+	if errors.Is(err, ErrCorrupt) {
+		c.problem("%s", err)
+		return nil
+	}
+	return err
+}
+
+func (c *checker) expect(from, id, kind, detail string) {
+	c.expected = append(c.expected, expectedObject{from, id, kind, detail})
+}
+
+// checkObjects verifies every file under objects/.
+func (c *checker) checkObjects() error {
+	err := fs.WalkDir(c.repo.store, objectsDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == objectsDir {
+			c.problem("%s: missing", objectsDir)
+			return fs.SkipDir
+		}
+		if err != nil {
+			return ioError(err)
+		}
+		rel := strings.TrimPrefix(name, objectsDir+"/")
+		dir, base := path.Split(rel)
+		switch {
+		case name == objectsDir:
+			return nil
+		case name == packDir && entry.IsDir():
+			return c.checkPacks()
+		case entry.IsDir() && (dir != "" || len(base) != 2):
+			c.problem("%s: unexpected directory", name)
+			return fs.SkipDir
+		case entry.IsDir():
+			return nil
+		case strings.HasSuffix(base, ".tmp"):
+			// Left by an interrupted write; gc removes it
+			return nil
+		}
+		id := strings.TrimSuffix(dir, "/") + base
+		if len(dir) != 3 || !ValidID(id) {
+			c.problem("%s: unexpected file", name)
+			return nil
+		}
+		return c.checkObject(id)
+	})
+	if err != nil {
+		return ioError(err)
+	}
+	return nil
+}
+
+// checkPacks verifies every pack and the objects it holds.
+func (c *checker) checkPacks() error {
+	entries, err := c.repo.store.ReadDir(packDir)
+	if err != nil {
+		return ioError(err)
+	}
+	for _, entry := range entries {
+		name := path.Join(packDir, entry.Name())
+		base, isIndex := strings.CutSuffix(name, ".idx")
+		switch {
+		case entry.IsDir():
+			c.problem("%s: unexpected directory", name)
+			continue
+		case strings.HasSuffix(name, ".pack"), strings.HasSuffix(name, ".tmp"):
+			// Checked with their index, or left by an interrupted write
+			continue
+		case !isIndex || !strings.HasPrefix(entry.Name(), packPrefix):
+			c.problem("%s: unexpected file", name)
+			continue
+		}
+		p, err := readPackIndex(c.repo.store, base)
+		if err != nil {
+			if err = c.report(err); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, object := range p.entries {
+			c.result.Objects++
+			encoded, err := c.repo.readPackEntry(p, object, 0)
+			if err == nil {
+				err = c.checkEncoded(object.id, fmt.Sprintf("%s.pack: object %s", base, object.id), encoded)
+			} else {
+				c.types[object.id] = ""
+			}
+			if err = c.report(err); err != nil {
+				return err
+			}
+		}
+	}
+	return fs.SkipDir
+}
+
+// checkObject verifies the loose object id.
+func (c *checker) checkObject(id string) error {
+	c.result.Objects++
+	encoded, err := readLoose(c.repo.store, objectPath(id))
+	if err != nil {
+		c.types[id] = ""
+		return c.report(err)
+	}
+	return c.checkEncoded(id, objectPath(id), encoded)
+}
+
+// checkEncoded verifies that the object id, stored as encoded in the file
+// name, hashes to its id and parses, and records what it refers to.
+func (c *checker) checkEncoded(id, name string, encoded []byte) error {
+	kind, data, err := decodeObject(name, encoded)
+	c.types[id] = kind
+	if err != nil {
+		return c.report(err)
+	}
+	if actual, _ := encodeObject(kind, data); actual != id {
+		c.problem("%s: the contents do not match the object id, they hash to %s", name, actual)
+	}
+	switch kind {
+	case ObjectTree:
+		snap, err := decodeTree(id, data)
+		if err != nil {
+			return c.report(err)
+		}
+		for _, entry := range snap.Files {
+			c.links[id] = append(c.links[id], entry.Object)
+			c.expect(name, entry.Object, ObjectBlob, fmt.Sprintf(" for '%s'", entry.Path))
+		}
+	case ObjectCommit:
+		commit, err := decodeCommit(id, data)
+		if err != nil {
+			return c.report(err)
+		}
+		c.links[id] = append([]string{commit.Tree}, commit.Parents...)
+		c.expect(name, commit.Tree, ObjectTree, "")
+		for _, parent := range commit.Parents {
+			c.expect(name, parent, ObjectCommit, " (parent)")
+		}
+	case ObjectPointer:
+		pointer, err := decodePointer(id, data)
+		if err != nil {
+			return c.report(err)
+		}
+		c.pointers[id] = pointerRef{name, pointer}
+	}
+	return nil
+}
+
+// checkLargeFiles verifies every file under large/.
+func (c *checker) checkLargeFiles() error {
+	err := fs.WalkDir(c.repo.store, largeDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == largeDir {
+			// Created with the first large file
+			return fs.SkipDir
+		}
+		if err != nil {
+			return ioError(err)
+		}
+		dir, base := path.Split(strings.TrimPrefix(name, largeDir+"/"))
+		id := strings.TrimSuffix(dir, "/") + base
+		switch {
+		case name == largeDir:
+			return nil
+		case entry.IsDir() && (dir != "" || len(base) != 2):
+			c.problem("%s: unexpected directory", name)
+			return fs.SkipDir
+		case entry.IsDir(), dir == "" && strings.HasSuffix(base, ".tmp"):
+			return nil
+		case len(dir) != 3 || !ValidID(id):
+			c.problem("%s: unexpected file", name)
+			return nil
+		}
+		c.result.Large++
+		size, err := checkLarge(c.repo.store, id)
+		if err != nil {
+			size = -1
+		}
+		c.large[id] = size
+		return c.report(err)
+	})
+	if err != nil {
+		return ioError(err)
+	}
+	return nil
+}
+
+// checkPointers verifies that the large file of every pointer exists with its size.
+func (c *checker) checkPointers() {
+	ids := make([]string, 0, len(c.pointers))
+	for id := range c.pointers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		ref := c.pointers[id]
+		switch size, ok := c.large[ref.pointer.Object]; {
+		case !ok:
+			c.problem("%s: missing large file %s", ref.name, ref.pointer.Object)
+		case size >= 0 && size != ref.pointer.Size:
+			c.problem("%s: large file %s has %d bytes, not %d", ref.name, ref.pointer.Object, size, ref.pointer.Size)
+		}
+	}
+}
+
+// checkRefs verifies the configuration, HEAD, the refs, the reflogs and the
+// index and returns the ids of the objects they refer to.
+func (c *checker) checkRefs() ([]string, error) {
+	repo := c.repo
+	var roots []string
+	_, err := ReadConfigFile(repo.store, configFilename)
+	if err = c.report(err); err != nil {
+		return nil, err
+	}
+	if err = c.report(repo.readHead()); err != nil {
+		return nil, err
+	}
+	if repo.branch == "" && repo.head != "" {
+		c.expect(headFilename, repo.head, ObjectCommit, "")
+		roots = append(roots, repo.head)
+	}
+	refs, err := repo.refNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range refs {
+		if !ValidRefName(strings.TrimPrefix(name, refsDir+"/")) {
+			c.problem("%s: bad ref name", name)
+		}
+		id, err := repo.readRef(name)
+		if err = c.report(err); err != nil {
+			return nil, err
+		}
+		if id != "" {
+			c.expect(name, id, ObjectCommit, "")
+			roots = append(roots, id)
+		}
+	}
+	logs, err := repo.reflogNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range logs {
+		entries, err := readReflog(repo.store, name)
+		if err = c.report(err); err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			for _, id := range []string{entry.Old, entry.New} {
+				if id != "" {
+					c.expect(reflogPath(name), id, ObjectCommit, "")
+					roots = append(roots, id)
+				}
+			}
+		}
+	}
+	if err = c.report(repo.readIndex()); err != nil {
+		return nil, err
+	}
+	for _, entry := range repo.index.Files {
+		c.expect(indexFilename, entry.Object, ObjectBlob, fmt.Sprintf(" for '%s'", entry.Path))
+		roots = append(roots, entry.Object)
+	}
+	return roots, nil
+}
+
+// findDangling lists the objects that cannot be reached from roots.
+func (c *checker) findDangling(roots []string) {
+	reachable := map[string]bool{}
+	for len(roots) > 0 {
+		id := roots[len(roots)-1]
+		roots = roots[:len(roots)-1]
+		if !reachable[id] {
+			reachable[id] = true
+			roots = append(roots, c.links[id]...)
+		}
+	}
+	for id, kind := range c.types {
+		if !reachable[id] && kind != "" {
+			c.result.Dangling = append(c.result.Dangling, DanglingObject{kind, id})
+		}
+	}
+	pointed := map[string]bool{}
+	for id, ref := range c.pointers {
+		pointed[ref.pointer.Object] = pointed[ref.pointer.Object] || reachable[id]
+	}
+	for id, size := range c.large {
+		if !pointed[id] && size >= 0 {
+			c.result.Dangling = append(c.result.Dangling, DanglingObject{largeDir, id})
+		}
+	}
+	sort.Slice(c.result.Dangling, func(i, j int) bool { return c.result.Dangling[i].ID < c.result.Dangling[j].ID })
+}
@@ -0,0 +1,114 @@
+package svcs
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newFsckRepository returns a repository with two commits on main and a
+// blob that was staged and then replaced.
+func newFsckRepository(t *testing.T) (*Repository, *Commit, *Commit, string) {
+	t.Helper()
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "a1")
+	mustAdd(t, repo, "a.txt")
+	first := mustCommit(t, repo, "first")
+	writeFile(t, repo.WorkTree(), "a.txt", "staged")
+	mustAdd(t, repo, "a.txt")
+	dangling := repo.index.lookup("a.txt")
+	writeFile(t, repo.WorkTree(), "a.txt", "a2")
+	mustAdd(t, repo, "a.txt")
+	second := mustCommit(t, repo, "second")
+	return repo, first, second, dangling
+}
+
+func TestFsck(t *testing.T) {
+	repo, _, _, dangling := newFsckRepository(t)
+	result, err := FsckFS(repo.Storage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two commits, two trees and three blobs
+	if result.Objects != 7 || len(result.Problems) != 0 {
+		t.Errorf("FsckFS() = %+v, want 7 objects and no problems", result)
+	}
+	if want := []DanglingObject{{ObjectBlob, dangling}}; !reflect.DeepEqual(result.Dangling, want) {
+		t.Errorf("Dangling = %v, want %v", result.Dangling, want)
+	}
+
+	if _, err := FsckFS(NewMemFS()); !errors.Is(err, ErrNotARepo) {
+		t.Errorf("checking nothing: got %v, want ErrNotARepo", err)
+	}
+}
+
+func TestFsckProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, repo *Repository, first, second *Commit)
+		want    string
+	}{
+		{"edited blob", func(t *testing.T, repo *Repository, first, second *Commit) {
+			blob := repo.index.lookup("a.txt")
+			writeFile(t, repo.Storage(), objectPath(blob), string(compress([]byte("blob 2\x00a3"))))
+		}, "the contents do not match the object id"},
+		{"truncated object", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), objectPath(first.Tree), string(compress([]byte("tree 100\x00{}"))))
+		}, "object size does not match its header"},
+		{"missing tree", func(t *testing.T, repo *Repository, first, second *Commit) {
+			if err := repo.Storage().Remove(objectPath(second.Tree)); err != nil {
+				t.Fatal(err)
+			}
+		}, "missing tree %tree%"},
+		{"missing parent", func(t *testing.T, repo *Repository, first, second *Commit) {
+			if err := repo.Storage().Remove(objectPath(first.Hash)); err != nil {
+				t.Fatal(err)
+			}
+		}, "missing commit %first% (parent)"},
+		{"branch to a blob", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), "refs/heads/other", repo.index.lookup("a.txt")+"\n")
+		}, "refs/heads/other: %blob% is a blob, not a commit"},
+		{"bad branch", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), "refs/heads/main", "main\n")
+		}, "refs/heads/main: bad commit id"},
+		{"bad HEAD", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), "HEAD", "main\n")
+		}, "HEAD: bad commit id"},
+		{"unknown detached HEAD", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), "HEAD", strings.Repeat("0", idLength)+"\n")
+		}, "HEAD: missing commit"},
+		{"bad index", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), "index.txt", `{"files":["a.txt"]}`)
+		}, "index.txt: json"},
+		{"not compressed", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), objectPath(first.Hash), "commit 2\x00{}")
+		}, "zlib: invalid header"},
+		{"stray file", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), "objects/ab/cd", "")
+		}, "objects/ab/cd: unexpected file"},
+		{"bad config", func(t *testing.T, repo *Repository, first, second *Commit) {
+			writeFile(t, repo.Storage(), "config.txt", "{")
+		}, "config.txt: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, first, second, _ := newFsckRepository(t)
+			want := strings.NewReplacer(
+				"%tree%", second.Tree, "%first%", first.Hash, "%blob%", repo.index.lookup("a.txt"),
+			).Replace(tt.want)
+			tt.corrupt(t, repo, first, second)
+			result, err := FsckFS(repo.Storage())
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := false
+			for _, problem := range result.Problems {
+				found = found || strings.Contains(problem, want)
+			}
+			if !found {
+				t.Errorf("Problems = %q, want one containing %q", result.Problems, want)
+			}
+		})
+	}
+}
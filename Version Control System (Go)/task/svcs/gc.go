@@ -0,0 +1,378 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultExpire is how long GC keeps unreachable objects unless gc.pruneExpire says otherwise.
+	DefaultExpire = 14 * 24 * time.Hour
+	// NeverExpire keeps unreachable objects forever.
+	NeverExpire time.Duration = -1
+	// packObjectLimit is the largest stored object that GC packs; larger ones stay loose.
+	packObjectLimit = 64 << 10
+)
+
+// ParseExpire parses a grace period: a Go duration such as "36h", a number
+// of days or weeks such as "14d" or "2w", "now" or "never".
+func ParseExpire(value string) (time.Duration, error) {
+	switch value {
+	case "now":
+		return 0, nil
+	case "never":
+		return NeverExpire, nil
+	}
+	var expire time.Duration
+	var err error
+	if n, ok := strings.CutSuffix(value, "d"); ok {
+		expire, err = parseDays(n, 1)
+	} else if n, ok := strings.CutSuffix(value, "w"); ok {
+		expire, err = parseDays(n, 7)
+	} else {
+		expire, err = time.ParseDuration(value)
+	}
+	if err != nil || expire < 0 {
+		return 0, fmt.Errorf("bad expiry '%s', expected a duration such as '2w', 'now' or 'never'", value)
+	}
+	return expire, nil
+}
+
+func parseDays(value string, days int) (time.Duration, error) {
+	n, err := strconv.Atoi(value)
+	return time.Duration(n*days) * 24 * time.Hour, err
+}
+
+// GCOptions controls GC.
+type GCOptions struct {
+	// Expire is how long unreachable objects are kept, or NeverExpire.
+	Expire time.Duration
+	// Now is the time their age is measured at; the zero Time means now.
+	Now time.Time
+}
+
+// GCResult describes what GC did.
+type GCResult struct {
+	// Pack is the name of the pack holding the packed objects, if there are any.
+	Pack   string `json:"pack,omitempty"`
+	Packed int    `json:"packed"`
+	// Loose is the number of reachable objects too large to pack.
+	Loose  int `json:"loose"`
+	Pruned int `json:"pruned"`
+	// Kept is the number of unreachable objects kept until they expire.
+	Kept int `json:"kept"`
+	// PrunedLarge and KeptLarge count the unreachable files of the
+	// large-object area like Pruned and Kept.
+	PrunedLarge int `json:"prunedLarge"`
+	KeptLarge   int `json:"keptLarge"`
+}
+
+// looseObject is an object stored in its own file.
+type looseObject struct {
+	id      string
+	size    int64
+	modTime time.Time
+}
+
+// GC removes the objects and large files that cannot be reached from HEAD,
+// the refs, their reflogs or the index once they are older than
+// options.Expire, and packs the small reachable objects, including those of
+// earlier packs, into a single pack. Unreachable objects are never repacked,
+// which would make them new again: they stay loose, and an earlier pack that
+// holds any stays until it expires. Large files are never packed.
+func (repo *Repository) GC(options GCOptions) (*GCResult, error) {
+	reachable, reachableLarge, err := repo.reachable()
+	if err != nil {
+		return nil, err
+	}
+	loose, stale, err := repo.looseObjects()
+	if err != nil {
+		return nil, err
+	}
+	packs, err := repo.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	now := options.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	cutoff := now.Add(-options.Expire)
+	expired := func(modTime time.Time) bool {
+		return options.Expire != NeverExpire && !modTime.After(cutoff)
+	}
+
+	result := &GCResult{}
+	var packed []packObject
+	seen := map[string]bool{}
+	// keep holds the earlier packs with unreachable objects yet to expire
+	keep := map[string]bool{}
+	for _, p := range packs {
+		for _, entry := range p.entries {
+			if seen[entry.id] {
+				continue
+			}
+			seen[entry.id] = true
+			hint, ok := reachable[entry.id]
+			if !ok && expired(p.modTime) {
+				result.Pruned++
+				continue
+			}
+			if !ok {
+				result.Kept++
+				keep[p.name] = true
+				continue
+			}
+			encoded, err := repo.readPackEntry(p, entry, 0)
+			if err != nil {
+				return nil, err
+			}
+			packed = append(packed, packObject{entry.id, encoded, hint})
+		}
+	}
+	var remove []string
+	for _, object := range loose {
+		name := objectPath(object.id)
+		hint, ok := reachable[object.id]
+		switch {
+		case seen[object.id]:
+			remove = append(remove, name)
+			continue
+		case !ok && expired(object.modTime):
+			result.Pruned++
+			remove = append(remove, name)
+		case !ok:
+			result.Kept++
+		case object.size > packObjectLimit:
+			result.Loose++
+		default:
+			encoded, err := readLoose(repo.store, name)
+			if err != nil {
+				return nil, err
+			}
+			packed = append(packed, packObject{object.id, encoded, hint})
+			remove = append(remove, name)
+		}
+		seen[object.id] = true
+	}
+	large, staleLarge, err := repo.largeFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range large {
+		switch {
+		case reachableLarge[file.id]:
+			// Large files stay where they are
+		case expired(file.modTime):
+			result.PrunedLarge++
+			remove = append(remove, largePath(file.id))
+		default:
+			result.KeptLarge++
+		}
+	}
+	for _, file := range append(stale, staleLarge...) {
+		if expired(file.modTime) {
+			remove = append(remove, file.id)
+		}
+	}
+
+	// Everything is in the new pack before anything else goes away
+	if len(packed) > 0 {
+		name, err := repo.writePack(packed)
+		if err != nil {
+			return nil, err
+		}
+		result.Pack, result.Packed = path.Base(name), len(packed)
+	}
+	for _, p := range packs {
+		if !keep[p.name] && path.Base(p.name) != result.Pack {
+			remove = append(remove, p.name+".idx", p.name+".pack")
+		}
+	}
+	for _, name := range remove {
+		if err := repo.store.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, ioError(err)
+		}
+	}
+	repo.packsLoaded = false
+	for _, dir := range []string{objectsDir, largeDir} {
+		if err := repo.removeEmptyDirs(dir); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// roots returns the ids of the objects that HEAD, the refs, their reflogs
+// and the index refer to.
+func (repo *Repository) roots() ([]string, error) {
+	var roots []string
+	if repo.head != "" {
+		roots = append(roots, repo.head)
+	}
+	refs, err := repo.refNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range refs {
+		id, err := repo.readRef(name)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, id)
+	}
+	logs, err := repo.reflogNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range logs {
+		entries, err := readReflog(repo.store, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Old != "" {
+				roots = append(roots, entry.Old)
+			}
+			roots = append(roots, entry.New)
+		}
+	}
+	for _, entry := range repo.index.Files {
+		roots = append(roots, entry.Object)
+	}
+	return roots, nil
+}
+
+// reachable maps the ids of the objects that can be reached from the roots,
+// which must all exist, to the path of a file they hold, for blobs and
+// pointers, or "". It also returns the set of large files pointed to.
+func (repo *Repository) reachable() (map[string]string, map[string]bool, error) {
+	roots, err := repo.roots()
+	if err != nil {
+		return nil, nil, err
+	}
+	type object struct{ id, hint string }
+	var pending []object
+	for _, id := range roots {
+		pending = append(pending, object{id, ""})
+	}
+	reachable, large := map[string]string{}, map[string]bool{}
+	for len(pending) > 0 {
+		id, hint := pending[len(pending)-1].id, pending[len(pending)-1].hint
+		pending = pending[:len(pending)-1]
+		if _, ok := reachable[id]; ok {
+			continue
+		}
+		reachable[id] = hint
+		name, encoded, err := repo.readEncoded(id)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, corruptError(objectPath(id), "missing object; run 'svcs fsck'")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		kind, data, err := decodeObject(name, encoded)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch kind {
+		case ObjectTree:
+			snap, err := decodeTree(id, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, entry := range snap.Files {
+				pending = append(pending, object{entry.Object, entry.Path})
+			}
+		case ObjectCommit:
+			commit, err := decodeCommit(id, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			pending = append(pending, object{commit.Tree, ""})
+			for _, parent := range commit.Parents {
+				pending = append(pending, object{parent, ""})
+			}
+		case ObjectPointer:
+			pointer, err := decodePointer(id, data)
+			if err != nil {
+				return nil, nil, err
+			}
+			large[pointer.Object] = true
+		}
+	}
+	return reachable, large, nil
+}
+
+// looseObjects lists the loose objects and, as stale, the files left by
+// interrupted writes, whose id is their name.
+func (repo *Repository) looseObjects() (objects, stale []looseObject, err error) {
+	err = fs.WalkDir(repo.store, objectsDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == objectsDir {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		dir, base := path.Split(name)
+		id := path.Base(dir) + base
+		switch {
+		case strings.HasSuffix(base, ".tmp"), dir == packDir+"/" && !repo.hasPackIndex(name):
+			stale = append(stale, looseObject{name, info.Size(), info.ModTime()})
+		case dir != packDir+"/" && ValidID(id):
+			objects = append(objects, looseObject{id, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, ioError(err)
+	}
+	return objects, stale, nil
+}
+
+// hasPackIndex reports whether the file name of the pack directory is an
+// index or a pack with one; a pack without is left by an interrupted write.
+func (repo *Repository) hasPackIndex(name string) bool {
+	base, ok := strings.CutSuffix(name, ".pack")
+	if !ok {
+		return true
+	}
+	_, err := repo.store.Stat(base + ".idx")
+	return err == nil
+}
+
+// removeEmptyDirs removes the fan-out directories of dir, objects/ or
+// large/, that no longer hold any file.
+func (repo *Repository) removeEmptyDirs(dir string) error {
+	entries, err := repo.store.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return ioError(err)
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		if !entry.IsDir() || name == packDir {
+			continue
+		}
+		if children, err := repo.store.ReadDir(name); err == nil && len(children) == 0 {
+			if err = repo.store.Remove(name); err != nil {
+				return ioError(err)
+			}
+		}
+	}
+	return nil
+}
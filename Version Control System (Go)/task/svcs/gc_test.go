@@ -0,0 +1,251 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExpire(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"now", 0, true},
+		{"never", NeverExpire, true},
+		{"2w", 14 * 24 * time.Hour, true},
+		{"3d", 72 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"-1h", 0, false},
+		{"xd", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseExpire(tt.value)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseExpire(%q) = %v, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestGC(t *testing.T) {
+	repo, first, second, dangling := newFsckRepository(t)
+	// A tag keeps a commit that is on no branch
+	writeFile(t, repo.WorkTree(), "a.txt", "tagged")
+	mustAdd(t, repo, "a.txt")
+	if _, err := repo.Checkout(first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "tagged")
+	mustAdd(t, repo, "a.txt")
+	tagged := mustCommit(t, repo, "tagged")
+	writeFile(t, repo.Storage(), "refs/tags/v1", tagged.Hash+"\n")
+	if _, err := repo.Checkout("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.GC(GCOptions{Expire: DefaultExpire})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Three commits, three trees and three blobs; the dangling blob stays loose
+	if result.Packed != 9 || result.Kept != 1 || result.Pruned != 0 || !strings.HasPrefix(result.Pack, "pack-") {
+		t.Errorf("GC() = %+v", result)
+	}
+	if _, err := repo.Storage().Stat(objectPath(dangling)); err != nil {
+		t.Errorf("the unreachable blob was not kept: %v", err)
+	}
+
+	result, err = repo.GC(GCOptions{Expire: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Packed != 9 || result.Pruned != 1 {
+		t.Errorf("GC() with no grace period = %+v", result)
+	}
+	if ok, err := repo.hasObject(dangling); ok || err != nil {
+		t.Errorf("the unreachable blob is still there: %v, %v", ok, err)
+	}
+	entries, err := repo.Storage().ReadDir(objectsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "pack" {
+		t.Errorf("objects after GC: %v, want only the pack directory", entries)
+	}
+	check, err := FsckFS(repo.Storage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Objects != 9 || len(check.Problems) != 0 || len(check.Dangling) != 0 {
+		t.Errorf("FsckFS() after GC = %+v", check)
+	}
+
+	// Packed objects are read like loose ones
+	repo, err = OpenFS(repo.WorkTree(), repo.Storage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit, err := repo.ResolveRevision(second.Hash[:6] + "~1"); err != nil || commit.Hash != first.Hash {
+		t.Errorf("resolving a packed commit: %v, %v", commit, err)
+	}
+	if _, err = repo.Checkout("v1"); err == nil {
+		t.Errorf("tags are not branches")
+	}
+	if _, err = repo.Checkout(tagged.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "tagged" {
+		t.Errorf("a.txt of the tagged commit = %q", got)
+	}
+}
+
+func TestGCExpiresPackedObjects(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "old")
+	mustAdd(t, repo, "a.txt")
+	old := repo.index.lookup("a.txt")
+	if _, err := repo.GC(GCOptions{Expire: DefaultExpire}); err != nil {
+		t.Fatal(err)
+	}
+	// The packed blob is no longer staged, so nothing leads to it
+	writeFile(t, repo.WorkTree(), "a.txt", "new")
+	mustAdd(t, repo, "a.txt")
+
+	result, err := repo.GC(GCOptions{Expire: DefaultExpire})
+	if err != nil || result.Kept != 1 || result.Pruned != 0 || result.Packed != 1 {
+		t.Fatalf("GC() = %+v, %v", result, err)
+	}
+	if ok, err := repo.hasObject(old); !ok || err != nil {
+		t.Fatalf("the unreachable blob was not kept: %v, %v", ok, err)
+	}
+	later := time.Now().Add(DefaultExpire + time.Hour)
+	result, err = repo.GC(GCOptions{Expire: DefaultExpire, Now: later})
+	if err != nil || result.Kept != 0 || result.Pruned != 1 || result.Packed != 1 {
+		t.Fatalf("GC() once expired = %+v, %v", result, err)
+	}
+	if ok, err := repo.hasObject(old); ok || err != nil {
+		t.Errorf("the unreachable blob is still there: %v, %v", ok, err)
+	}
+	packs, err := repo.loadPacks()
+	if err != nil || len(packs) != 1 {
+		t.Errorf("packs after GC = %v, %v, want one", packs, err)
+	}
+}
+
+func TestGCLeavesLargeObjectsLoose(t *testing.T) {
+	repo := newTestRepository(t)
+	// Random data does not compress
+	big := make([]byte, packObjectLimit)
+	rand.New(rand.NewSource(1)).Read(big)
+	writeFile(t, repo.WorkTree(), "big", string(big))
+	mustAdd(t, repo, "big")
+	mustCommit(t, repo, "big")
+	result, err := repo.GC(GCOptions{Expire: NeverExpire})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Packed != 2 || result.Loose != 1 {
+		t.Errorf("GC() = %+v, want the commit and tree packed and the blob loose", result)
+	}
+	if _, err := repo.Storage().Stat(objectPath(repo.index.lookup("big"))); err != nil {
+		t.Errorf("the large blob is not loose: %v", err)
+	}
+}
+
+func TestGCMissingObject(t *testing.T) {
+	repo, first, _, _ := newFsckRepository(t)
+	if err := repo.Storage().Remove(objectPath(first.Tree)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GC(GCOptions{Expire: 0}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("GC() with a missing object: got %v, want ErrCorrupt", err)
+	}
+}
+
+func TestFsckPack(t *testing.T) {
+	repo, _, _, _ := newFsckRepository(t)
+	result, err := repo.GC(GCOptions{Expire: NeverExpire})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := packDir + "/" + result.Pack + ".pack"
+	data := []byte(readFile(t, repo.Storage(), name))
+	// Change a byte of the last object
+	data[len(data)-3] ^= 1
+	writeFile(t, repo.Storage(), name, string(data))
+	check, err := FsckFS(repo.Storage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Problems) == 0 || !strings.Contains(check.Problems[0], "zlib: invalid checksum") {
+		t.Errorf("Problems = %q", check.Problems)
+	}
+
+	// Problems in packed objects are reported against the pack
+	id := strings.Repeat("ab", idLength/2)
+	bad, err := repo.writePack([]packObject{{id, []byte("no header"), ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err = FsckFS(repo.Storage())
+	want := fmt.Sprintf("%s.pack: object %s: missing object header", bad, id)
+	if err != nil || !slices.ContainsFunc(check.Problems, func(problem string) bool { return strings.Contains(problem, want) }) {
+		t.Errorf("FsckFS() with a bad packed object = %+v, %v, want a problem with %q", check, err, want)
+	}
+	for _, ext := range []string{".idx", ".pack"} {
+		if err = repo.Storage().Remove(bad + ext); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile(t, repo.Storage(), packDir+"/"+result.Pack+".idx", packIndexHeader+"1234")
+	if check, err = FsckFS(repo.Storage()); err != nil || len(check.Problems) == 0 || !strings.Contains(check.Problems[0], "truncated") {
+		t.Errorf("FsckFS() with a bad pack index = %+v, %v", check, err)
+	}
+}
+
+func TestGCDeltas(t *testing.T) {
+	repo := newTestRepository(t)
+	var commits []*Commit
+	var versions []string
+	content := strings.Repeat("the same text in every version\n", 50)
+	for i := 0; i < 20; i++ {
+		content += fmt.Sprintf("line %d of a file that grows with every commit\n", i)
+		writeFile(t, repo.WorkTree(), "a.txt", content)
+		mustAdd(t, repo, "a.txt")
+		commits = append(commits, mustCommit(t, repo, fmt.Sprintf("version %d", i)))
+		versions = append(versions, content)
+	}
+	before, err := repo.CountObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Loose != 60 || before.Packed != 0 || before.LooseSize >= before.Size {
+		t.Errorf("CountObjects() before GC = %+v, want 60 compressed loose objects", before)
+	}
+	if _, err = repo.GC(GCOptions{Expire: NeverExpire}); err != nil {
+		t.Fatal(err)
+	}
+	after, err := repo.CountObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Loose != 0 || after.Packed != 60 || after.Deltas < 30 || after.Size != before.Size || after.PackSize >= before.LooseSize {
+		t.Errorf("CountObjects() after GC = %+v, want 60 packed objects, mostly deltas, in less space than %+v", after, before)
+	}
+	for i, commit := range commits {
+		if _, err = repo.Checkout(commit.Hash); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, repo.WorkTree(), "a.txt"); got != versions[i] {
+			t.Errorf("a.txt of version %d = %q, want %q", i, got, versions[i])
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package svcs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Files that are at least core.largeFileThreshold bytes or match one of the
+// patterns of core.largeFilePatterns are kept whole, uncompressed, in the
+// large-object area under large/, named after the hash of their contents.
+// Trees refer to them through a pointer object holding that id and the size,
+// so they are streamed rather than read into memory and never packed.
+const largeDir = "large"
+
+// largePointer is the contents of a pointer object.
+type largePointer struct {
+	Object string `json:"object"`
+	Size   int64  `json:"size"`
+}
+
+func largePath(id string) string {
+	return path.Join(largeDir, id[:2], id[2:])
+}
+
+// decodePointer parses the contents of the pointer object id.
+func decodePointer(id string, data []byte) (largePointer, error) {
+	var pointer largePointer
+	name := objectPath(id)
+	if err := decodeStrict(name, data, &pointer); err != nil {
+		return pointer, err
+	}
+	if !ValidID(pointer.Object) {
+		return pointer, corruptError(name, "bad large file id '%s'", pointer.Object)
+	}
+	if pointer.Size < 0 {
+		return pointer, corruptError(name, "bad size %d", pointer.Size)
+	}
+	return pointer, nil
+}
+
+func encodePointer(pointer largePointer) []byte {
+	// Marshalling a largePointer does not fail
+	data, _ := json.Marshal(pointer)
+	return data
+}
+
+// isLarge reports whether the work tree file name of the given size belongs
+// in the large-object area.
+func (repo *Repository) isLarge(name string, size int64) (bool, error) {
+	threshold, err := repo.Config.GetInt("core.largeFileThreshold")
+	if err != nil {
+		return false, fmt.Errorf("core.largeFileThreshold: %w", err)
+	}
+	if threshold > 0 && size >= int64(threshold) {
+		return true, nil
+	}
+	for _, pattern := range strings.Fields(repo.Config.GetString("core.largeFilePatterns")) {
+		// Patterns without a slash match the base name in any directory
+		subject := name
+		if !strings.Contains(pattern, "/") {
+			subject = path.Base(name)
+		}
+		ok, err := path.Match(pattern, subject)
+		if err != nil {
+			return false, fmt.Errorf("core.largeFilePatterns: bad pattern '%s'", pattern)
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// fileID returns the id of the object that staging the work tree file name
+// of the given size would record, without storing anything.
+func (repo *Repository) fileID(name string, size int64) (string, error) {
+	large, err := repo.isLarge(name, size)
+	if err != nil {
+		return "", err
+	}
+	if !large {
+		data, err := repo.work.ReadFile(name)
+		if err != nil {
+			return "", ioError(err)
+		}
+		id, _ := encodeObject(ObjectBlob, data)
+		return id, nil
+	}
+	pointer, err := hashLarge(repo.work, name, io.Discard)
+	if err != nil {
+		return "", err
+	}
+	id, _ := encodeObject(ObjectPointer, encodePointer(pointer))
+	return id, nil
+}
+
+// hashLarge streams the file name of fsys to w and returns its pointer.
+func hashLarge(fsys FS, name string, w io.Writer) (largePointer, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return largePointer{}, ioError(err)
+	}
+	defer file.Close()
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(sum, w), file)
+	if err != nil {
+		return largePointer{}, ioError(err)
+	}
+	return largePointer{largeID(sum), size}, nil
+}
+
+func largeID(sum hash.Hash) string {
+	return hex.EncodeToString(sum.Sum(nil)[:idLength/2])
+}
+
+// writeLarge copies the work tree file name to the large-object area and
+// returns the id of its pointer object.
+func (repo *Repository) writeLarge(name string) (string, error) {
+	if err := repo.store.MkdirAll(largeDir); err != nil {
+		return "", ioError(err)
+	}
+	// The id is only known once the whole file has been read, so every write
+	// gets a temporary file of its own
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	incoming := path.Join(largeDir, "incoming-"+hex.EncodeToString(suffix)+".tmp")
+	out, err := repo.store.Create(incoming)
+	if err != nil {
+		return "", ioError(err)
+	}
+	pointer, err := hashLarge(repo.work, name, out)
+	if closeErr := out.Close(); err == nil {
+		err = ioError(closeErr)
+	}
+	if err == nil {
+		target := largePath(pointer.Object)
+		if _, err = repo.store.Stat(target); err == nil {
+			err = repo.store.Remove(incoming)
+		} else if err = repo.store.MkdirAll(path.Dir(target)); err == nil {
+			err = repo.store.Rename(incoming, target)
+		}
+		err = ioError(err)
+	}
+	if err != nil {
+		repo.store.Remove(incoming)
+		return "", err
+	}
+	return repo.writeObject(ObjectPointer, encodePointer(pointer))
+}
+
+// readFile returns the type of the object id of a tracked file, a blob or a
+// pointer, and its contents.
+func (repo *Repository) readFile(id string) (string, []byte, error) {
+	if !ValidID(id) {
+		return "", nil, NewError(ErrUnknownRevision, "bad object id '%s'", id)
+	}
+	name, encoded, err := repo.readEncoded(id)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, corruptError(objectPath(id), "missing blob object")
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	kind, data, err := decodeObject(name, encoded)
+	if err != nil {
+		return "", nil, err
+	}
+	if kind != ObjectBlob && kind != ObjectPointer {
+		return "", nil, corruptError(name, "expected a blob object, found a %s", kind)
+	}
+	return kind, data, nil
+}
+
+// writeWorkFile writes the contents of the object id to the work tree file
+// name, streaming them from the large-object area for a pointer.
+func (repo *Repository) writeWorkFile(name, id string) error {
+	kind, data, err := repo.readFile(id)
+	if err != nil {
+		return err
+	}
+	if kind == ObjectBlob {
+		return ioError(repo.work.WriteFile(name, data))
+	}
+	pointer, err := decodePointer(id, data)
+	if err != nil {
+		return err
+	}
+	in, err := repo.openLarge(pointer)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := repo.work.Create(name)
+	if err != nil {
+		return ioError(err)
+	}
+	n, err := io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ioError(err)
+	}
+	if n != pointer.Size {
+		return corruptError(largePath(pointer.Object), "the file has %d bytes, not %d", n, pointer.Size)
+	}
+	return nil
+}
+
+// openLarge opens the large file of pointer.
+func (repo *Repository) openLarge(pointer largePointer) (fs.File, error) {
+	file, err := repo.store.Open(largePath(pointer.Object))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, corruptError(largePath(pointer.Object), "missing large file")
+	}
+	return file, ioError(err)
+}
+
+// largeFiles lists the files of the large-object area and, as stale, the
+// files left by interrupted writes, whose id is their name.
+func (repo *Repository) largeFiles() (files, stale []looseObject, err error) {
+	err = fs.WalkDir(repo.store, largeDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == largeDir {
+			return fs.SkipDir
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		dir, base := path.Split(name)
+		id := path.Base(dir) + base
+		switch {
+		case strings.HasSuffix(base, ".tmp"):
+			stale = append(stale, looseObject{name, info.Size(), info.ModTime()})
+		case dir != largeDir+"/" && ValidID(id):
+			files = append(files, looseObject{id, info.Size(), info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, ioError(err)
+	}
+	return files, stale, nil
+}
+
+// checkLarge verifies that the large file id hashes to its id and returns its size.
+func checkLarge(store FS, id string) (int64, error) {
+	pointer, err := hashLarge(store, largePath(id), io.Discard)
+	if err != nil {
+		return 0, err
+	}
+	if pointer.Object != id {
+		return 0, corruptError(largePath(id), "the contents do not match the file id, they hash to %s", pointer.Object)
+	}
+	return pointer.Size, nil
+}
@@ -0,0 +1,236 @@
+package svcs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// newLargeRepository returns a repository that keeps files of 64 bytes or
+// more, and *.bin files, in the large-object area.
+func newLargeRepository(t *testing.T) *Repository {
+	t.Helper()
+	repo := newTestRepository(t)
+	for key, value := range map[string]string{
+		"core.largeFileThreshold": "64",
+		"core.largeFilePatterns":  "*.bin fixtures/*.dat",
+	} {
+		if err := repo.Config.Set(ScopeRepository, key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+func TestIsLarge(t *testing.T) {
+	repo := newLargeRepository(t)
+	tests := []struct {
+		name string
+		size int64
+		want bool
+	}{
+		{"a.txt", 10, false},
+		{"a.txt", 64, true},
+		{"a.bin", 0, true},
+		{"dir/a.bin", 0, true},
+		{"fixtures/a.dat", 0, true},
+		{"other/fixtures/a.dat", 0, false},
+	}
+	for _, tt := range tests {
+		if got, err := repo.isLarge(tt.name, tt.size); got != tt.want || err != nil {
+			t.Errorf("isLarge(%q, %d) = %v, %v, want %v", tt.name, tt.size, got, err, tt.want)
+		}
+	}
+	if err := repo.Config.Set(ScopeRepository, "core.largeFilePatterns", "[a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.isLarge("a.txt", 0); err == nil || !strings.Contains(err.Error(), "bad pattern") {
+		t.Errorf("isLarge() with a bad pattern: %v", err)
+	}
+}
+
+func TestLargeFiles(t *testing.T) {
+	repo := newLargeRepository(t)
+	big := strings.Repeat("large file contents\n", 10)
+	writeFile(t, repo.WorkTree(), "big.txt", big)
+	writeFile(t, repo.WorkTree(), "small.txt", "small")
+	mustAdd(t, repo, "big.txt", "small.txt")
+	first := mustCommit(t, repo, "first")
+
+	pointer := repo.index.lookup("big.txt")
+	if kind, _, err := repo.readFile(pointer); kind != ObjectPointer || err != nil {
+		t.Fatalf("big.txt is stored as a %s: %v", kind, err)
+	}
+	entries, err := repo.Storage().ReadDir(largeDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("large/ holds %v, %v", entries, err)
+	}
+	if statuses, err := repo.Status(); err != nil || statuses[0].Unstaged != StateUnmodified {
+		t.Errorf("Status() of an unchanged large file = %v, %v", statuses, err)
+	}
+
+	writeFile(t, repo.WorkTree(), "big.txt", big+"more\n")
+	if statuses, err := repo.Status(); err != nil || statuses[0].Unstaged != StateModified {
+		t.Errorf("Status() of a changed large file = %v, %v", statuses, err)
+	}
+	diffs, err := repo.Diff("")
+	if err != nil || len(diffs) != 1 || diffs[0].Patch != "Large files a/big.txt and b/big.txt differ\n" {
+		t.Errorf("Diff() = %+v, %v", diffs, err)
+	}
+	mustAdd(t, repo, "big.txt")
+	mustCommit(t, repo, "second")
+
+	if _, err = repo.Checkout(first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, repo.WorkTree(), "big.txt"); got != big {
+		t.Errorf("big.txt after checkout = %q, want %q", got, big)
+	}
+	check, err := FsckFS(repo.Storage())
+	if err != nil || check.Large != 2 || len(check.Problems) != 0 || len(check.Dangling) != 0 {
+		t.Errorf("FsckFS() = %+v, %v", check, err)
+	}
+
+	// Large files are never packed and stay while reachable
+	result, err := repo.GC(GCOptions{Expire: 0})
+	if err != nil || result.PrunedLarge != 0 {
+		t.Fatalf("GC() = %+v, %v", result, err)
+	}
+	if got := readFile(t, repo.Storage(), largePath(largeIDOf(t, repo, pointer))); got != big {
+		t.Errorf("the large file after GC = %q", got)
+	}
+}
+
+func TestWriteLargeFailure(t *testing.T) {
+	repo := newLargeRepository(t)
+	if _, err := repo.writeLarge("missing.bin"); !errors.Is(err, ErrIO) {
+		t.Fatalf("writeLarge() of a missing file: got %v, want ErrIO", err)
+	}
+	if entries, err := repo.Storage().ReadDir(largeDir); err != nil || len(entries) != 0 {
+		t.Errorf("a failed write left %v, %v in large/", entries, err)
+	}
+}
+
+func TestLargeFilesGC(t *testing.T) {
+	repo := newLargeRepository(t)
+	writeFile(t, repo.WorkTree(), "a.bin", "staged")
+	mustAdd(t, repo, "a.bin")
+	dangling := largeIDOf(t, repo, repo.index.lookup("a.bin"))
+	writeFile(t, repo.WorkTree(), "a.bin", "committed")
+	mustAdd(t, repo, "a.bin")
+	mustCommit(t, repo, "first")
+
+	check, err := FsckFS(repo.Storage())
+	if err != nil || len(check.Problems) != 0 {
+		t.Fatalf("FsckFS() = %+v, %v", check, err)
+	}
+	found := false
+	for _, object := range check.Dangling {
+		found = found || object == DanglingObject{largeDir, dangling}
+	}
+	if !found {
+		t.Errorf("Dangling = %v, want the staged large file %s", check.Dangling, dangling)
+	}
+
+	result, err := repo.GC(GCOptions{Expire: NeverExpire})
+	if err != nil || result.KeptLarge != 1 || result.PrunedLarge != 0 {
+		t.Errorf("GC() = %+v, %v", result, err)
+	}
+	result, err = repo.GC(GCOptions{Expire: 0})
+	if err != nil || result.PrunedLarge != 1 {
+		t.Errorf("GC() with no grace period = %+v, %v", result, err)
+	}
+	if _, err = repo.Storage().Stat(largePath(dangling)); err == nil {
+		t.Errorf("the unreachable large file is still there")
+	}
+	if _, err = repo.Checkout("main"); err != nil || readFile(t, repo.WorkTree(), "a.bin") != "committed" {
+		t.Errorf("checkout after GC: %v", err)
+	}
+}
+
+func TestFsckLargeFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, repo *Repository, id string)
+		want    string
+	}{
+		{"edited", func(t *testing.T, repo *Repository, id string) {
+			writeFile(t, repo.Storage(), largePath(id), "edited")
+		}, "the contents do not match the file id"},
+		{"missing", func(t *testing.T, repo *Repository, id string) {
+			if err := repo.Storage().Remove(largePath(id)); err != nil {
+				t.Fatal(err)
+			}
+		}, "missing large file %id%"},
+		{"stray file", func(t *testing.T, repo *Repository, id string) {
+			writeFile(t, repo.Storage(), "large/stray", "")
+		}, "large/stray: unexpected file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newLargeRepository(t)
+			writeFile(t, repo.WorkTree(), "a.bin", "contents")
+			mustAdd(t, repo, "a.bin")
+			mustCommit(t, repo, "first")
+			id := largeIDOf(t, repo, repo.index.lookup("a.bin"))
+			tt.corrupt(t, repo, id)
+			check, err := FsckFS(repo.Storage())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.ReplaceAll(tt.want, "%id%", id)
+			if len(check.Problems) != 1 || !strings.Contains(check.Problems[0], want) {
+				t.Errorf("Problems = %q, want one containing %q", check.Problems, want)
+			}
+		})
+	}
+}
+
+// largeIDOf returns the id of the large file of the pointer object id.
+func largeIDOf(t *testing.T, repo *Repository, id string) string {
+	t.Helper()
+	data, err := repo.readObject(id, ObjectPointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pointer, err := decodePointer(id, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pointer.Object
+}
+
+func TestOpenFileAt(t *testing.T) {
+	repo := newLargeRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "first")
+	writeFile(t, repo.WorkTree(), "a.bin", "large")
+	mustAdd(t, repo, "a.txt", "a.bin")
+	mustCommit(t, repo, "first")
+	writeFile(t, repo.WorkTree(), "a.txt", "second")
+	mustAdd(t, repo, "a.txt")
+	mustCommit(t, repo, "second")
+
+	tests := []struct {
+		rev, name, want string
+	}{
+		{"HEAD", "a.txt", "second"},
+		{"HEAD~1", "a.txt", "first"},
+		{"HEAD~1", "./a.bin", "large"},
+	}
+	for _, tt := range tests {
+		file, err := repo.OpenFileAt(tt.rev, tt.name)
+		if err != nil {
+			t.Errorf("OpenFileAt(%q, %q): %v", tt.rev, tt.name, err)
+			continue
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if string(data) != tt.want || err != nil {
+			t.Errorf("OpenFileAt(%q, %q) = %q, %v, want %q", tt.rev, tt.name, data, err, tt.want)
+		}
+	}
+	if _, err := repo.OpenFileAt("HEAD", "missing.txt"); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("OpenFileAt() of a missing file: got %v, want ErrUnknownRevision", err)
+	}
+}
@@ -0,0 +1,201 @@
+package svcs
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LogOptions selects the commits that Log returns. The zero value selects all of them.
+type LogOptions struct {
+	// Max is the maximum number of commits, 0 for no limit.
+	Max int
+	// Since and Until, when set, exclude commits dated before or after them.
+	Since, Until time.Time
+	// Author, when set, must match "name <email>" of the author.
+	Author *regexp.Regexp
+	// Grep, when set, must match the message.
+	Grep *regexp.Regexp
+	// Paths, when given, limit the log to commits that changed a file at or
+	// under one of them relative to their first parent.
+	Paths []string
+	// All starts from every ref as well as from HEAD.
+	All bool
+}
+
+// Log returns the commits reachable from HEAD that match opts. Every commit
+// comes before its parents; otherwise the newest come first.
+func (repo *Repository) Log(opts LogOptions) ([]Commit, error) {
+	paths := make([]string, len(opts.Paths))
+	for i, path := range opts.Paths {
+		clean, err := CleanPath(path)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = clean
+	}
+	var starts []string
+	if repo.head != "" {
+		starts = append(starts, repo.head)
+	}
+	if opts.All {
+		refs, err := repo.Refs()
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			starts = append(starts, ref.Commit)
+		}
+	}
+	history, err := repo.history(starts)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, commit := range history {
+		if opts.Max > 0 && len(commits) == opts.Max {
+			break
+		}
+		ok, err := repo.matchLog(commit, opts, paths)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			commits = append(commits, *commit)
+		}
+	}
+	return commits, nil
+}
+
+// history returns the commits reachable from the commits starts, each after
+// all of its children and otherwise newest first. Commits of the same date
+// keep the order in which they were reached.
+func (repo *Repository) history(starts []string) ([]*Commit, error) {
+	var reached []*Commit
+	seen := map[string]bool{}
+	children := map[string]int{}
+	for queue := starts; len(queue) > 0; {
+		id := queue[0]
+		queue = queue[1:]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		commit, err := repo.ReadCommit(id)
+		if err != nil {
+			return nil, err
+		}
+		reached = append(reached, commit)
+		for i, parent := range commit.Parents {
+			if !slices.Contains(commit.Parents[:i], parent) {
+				children[parent]++
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	var ready, sorted []*Commit
+	for _, commit := range reached {
+		if children[commit.Hash] == 0 {
+			ready = append(ready, commit)
+		}
+	}
+	order := map[string]int{}
+	for i, commit := range reached {
+		order[commit.Hash] = i
+	}
+	for len(ready) > 0 {
+		next := 0
+		for i, commit := range ready {
+			if commit.Date.After(ready[next].Date) || (commit.Date.Equal(ready[next].Date) && order[commit.Hash] < order[ready[next].Hash]) {
+				next = i
+			}
+		}
+		commit := ready[next]
+		ready = slices.Delete(ready, next, next+1)
+		sorted = append(sorted, commit)
+		for i, parent := range commit.Parents {
+			if slices.Contains(commit.Parents[:i], parent) {
+				continue
+			}
+			if children[parent]--; children[parent] == 0 {
+				ready = append(ready, reached[order[parent]])
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// matchLog reports whether commit is selected by opts, with paths cleaned.
+func (repo *Repository) matchLog(commit *Commit, opts LogOptions, paths []string) (bool, error) {
+	switch {
+	case !opts.Since.IsZero() && commit.Date.Before(opts.Since),
+		!opts.Until.IsZero() && commit.Date.After(opts.Until),
+		opts.Author != nil && !opts.Author.MatchString(formatAuthor(commit)),
+		opts.Grep != nil && !opts.Grep.MatchString(commit.Message):
+		return false, nil
+	}
+	if len(paths) == 0 {
+		return true, nil
+	}
+	var parent *Commit
+	if len(commit.Parents) > 0 {
+		var err error
+		if parent, err = repo.ReadCommit(commit.Parents[0]); err != nil {
+			return false, err
+		}
+	}
+	old, err := repo.treeOf(parent)
+	if err != nil {
+		return false, err
+	}
+	snap, err := repo.readTree(commit.Tree)
+	if err != nil {
+		return false, err
+	}
+	return filesUnder(old, paths) != filesUnder(snap, paths), nil
+}
+
+// filesUnder lists the files of snap at or under one of paths with their
+// objects, one per line.
+func filesUnder(snap snapshot, paths []string) string {
+	var b strings.Builder
+	for _, entry := range snap.Files {
+		for _, path := range paths {
+			if path == "." || entry.Path == path || strings.HasPrefix(entry.Path, path+"/") {
+				fmt.Fprintf(&b, "%s %s\n", entry.Object, entry.Path)
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+func formatAuthor(commit *Commit) string {
+	if commit.Email == "" {
+		return commit.Author
+	}
+	return fmt.Sprintf("%s <%s>", commit.Author, commit.Email)
+}
+
+// ParseDate parses a date for LogOptions: "2006-01-02", "2006-01-02 15:04:05"
+// in the local time zone, RFC 3339, or how long before now as for ParseExpire,
+// such as "2w" or "36h", optionally followed by " ago".
+func ParseDate(value string, now time.Time) (time.Time, error) {
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	for _, layout := range []string{time.DateOnly, time.DateTime} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	if value != "never" {
+		if ago, err := ParseExpire(strings.TrimSuffix(value, " ago")); err == nil {
+			return now.Add(-ago), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date '%s', expected YYYY-MM-DD, RFC 3339 or a duration such as '2w'", value)
+}
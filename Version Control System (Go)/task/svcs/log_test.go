@@ -0,0 +1,137 @@
+package svcs
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	repo := newTestRepository(t)
+	for _, step := range []struct {
+		date, author, file, message string
+	}{
+		{"2024-05-01T12:00:00Z", "Ann", "a.txt", "add a"},
+		{"2024-05-02T12:00:00Z", "Bob", "dir/b.txt", "add b"},
+		{"2024-05-03T12:00:00Z", "Ann", "a.txt", "fix a\n\nCloses #1."},
+	} {
+		t.Setenv("SVCS_AUTHOR_DATE", step.date)
+		if err := repo.Config.Set(ScopeRepository, "user.name", step.author); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, repo.WorkTree(), step.file, step.message)
+		mustAdd(t, repo, step.file)
+		mustCommit(t, repo, step.message)
+	}
+
+	tests := []struct {
+		name string
+		opts LogOptions
+		want []string
+	}{
+		{"all", LogOptions{}, []string{"fix a", "add b", "add a"}},
+		{"max", LogOptions{Max: 2}, []string{"fix a", "add b"}},
+		{"since", LogOptions{Since: time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)}, []string{"fix a", "add b"}},
+		{"until", LogOptions{Until: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)}, []string{"add a"}},
+		{"author", LogOptions{Author: regexp.MustCompile("^Ann")}, []string{"fix a", "add a"}},
+		{"grep body", LogOptions{Grep: regexp.MustCompile("#1")}, []string{"fix a"}},
+		{"file", LogOptions{Paths: []string{"a.txt"}}, []string{"fix a", "add a"}},
+		{"directory", LogOptions{Paths: []string{"dir/"}}, []string{"add b"}},
+		{"prefix is not a directory", LogOptions{Paths: []string{"di"}}, nil},
+		{"filters and max", LogOptions{Author: regexp.MustCompile("Ann"), Max: 1}, []string{"fix a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commits, err := repo.Log(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, commit := range commits {
+				got = append(got, commit.Subject())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Log() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Log() = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+	if _, err := repo.Log(LogOptions{Paths: []string{"../a.txt"}}); err == nil {
+		t.Errorf("Log() with a path outside the work tree succeeded")
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"2024-05-01T10:00:00+02:00", time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), true},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local), true},
+		{"2024-05-01 08:30:00", time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local), true},
+		{"2w", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), true},
+		{"3d ago", time.Date(2024, 5, 12, 12, 0, 0, 0, time.UTC), true},
+		{"now", now, true},
+		{"never", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.value, now)
+		if !got.Equal(tt.want) || (err == nil) != tt.ok {
+			t.Errorf("ParseDate(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestLogAll(t *testing.T) {
+	repo := newTestRepository(t)
+	var commits []*Commit
+	for i, message := range []string{"one", "two", "three"} {
+		t.Setenv("SVCS_AUTHOR_DATE", time.Date(2024, 5, 1+i, 0, 0, 0, 0, time.UTC).Format(time.RFC3339))
+		writeFile(t, repo.WorkTree(), "a.txt", message)
+		mustAdd(t, repo, "a.txt")
+		commits = append(commits, mustCommit(t, repo, message))
+	}
+	if _, err := repo.Checkout(commits[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+	// Older than "three", yet on a branch of its own
+	t.Setenv("SVCS_AUTHOR_DATE", "2024-05-02T12:00:00Z")
+	writeFile(t, repo.WorkTree(), "b.txt", "side")
+	mustAdd(t, repo, "b.txt")
+	side := mustCommit(t, repo, "side")
+	writeFile(t, repo.Storage(), "refs/tags/v1", side.Hash+"\n")
+	if _, err := repo.Checkout("main"); err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := repo.Refs()
+	want := []Ref{{"refs/heads/main", commits[2].Hash}, {"refs/tags/v1", side.Hash}}
+	if err != nil || !reflect.DeepEqual(refs, want) {
+		t.Errorf("Refs() = %v, %v, want %v", refs, err, want)
+	}
+	for _, tt := range []struct {
+		opts LogOptions
+		want []string
+	}{
+		{LogOptions{}, []string{"three", "two", "one"}},
+		{LogOptions{All: true}, []string{"three", "side", "two", "one"}},
+		{LogOptions{All: true, Max: 2}, []string{"three", "side"}},
+	} {
+		log, err := repo.Log(tt.opts)
+		var got []string
+		for _, commit := range log {
+			got = append(got, commit.Subject())
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Log(%+v) = %q, %v, want %q", tt.opts, got, err, tt.want)
+		}
+	}
+}
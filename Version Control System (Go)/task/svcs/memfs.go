@@ -0,0 +1,326 @@
+package svcs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+	errDirNotEmpty = errors.New("directory not empty")
+)
+
+// MemFS is an FS kept in memory, for virtual trees and tests. It is safe for concurrent use.
+type MemFS struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode
+}
+
+type memNode struct {
+	data    []byte
+	dir     bool
+	modTime time.Time
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{nodes: map[string]*memNode{".": {dir: true, modTime: time.Now()}}}
+}
+
+func pathError(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// lookup returns the node of name, or a *fs.PathError for op.
+func (fsys *MemFS) lookup(op, name string) (*memNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, pathError(op, name, fs.ErrInvalid)
+	}
+	node, ok := fsys.nodes[name]
+	if !ok {
+		return nil, pathError(op, name, fs.ErrNotExist)
+	}
+	return node, nil
+}
+
+// checkParent verifies that the directory that would contain name exists.
+func (fsys *MemFS) checkParent(op, name string) error {
+	if !fs.ValidPath(name) || name == "." {
+		return pathError(op, name, fs.ErrInvalid)
+	}
+	parent, ok := fsys.nodes[path.Dir(name)]
+	if !ok {
+		return pathError(op, name, fs.ErrNotExist)
+	}
+	if !parent.dir {
+		return pathError(op, name, errNotDir)
+	}
+	return nil
+}
+
+func (fsys *MemFS) Open(name string) (fs.File, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	node, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file := &memFile{info: node.info(name)}
+	if node.dir {
+		file.entries = fsys.readDir(name)
+	} else {
+		file.Reader = bytes.NewReader(node.data)
+	}
+	return file, nil
+}
+
+func (fsys *MemFS) Stat(name string) (fs.FileInfo, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	node, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(name), nil
+}
+
+func (fsys *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	node, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.dir {
+		return nil, pathError("readdir", name, errNotDir)
+	}
+	return fsys.readDir(name), nil
+}
+
+func (fsys *MemFS) readDir(name string) []fs.DirEntry {
+	var entries []fs.DirEntry
+	for child, node := range fsys.nodes {
+		if child != "." && path.Dir(child) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(node.info(child)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+func (fsys *MemFS) ReadFile(name string) ([]byte, error) {
+	fsys.mu.RLock()
+	defer fsys.mu.RUnlock()
+	node, err := fsys.lookup("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if node.dir {
+		return nil, pathError("read", name, errIsDir)
+	}
+	return bytes.Clone(node.data), nil
+}
+
+func (fsys *MemFS) Create(name string) (io.WriteCloser, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	node, err := fsys.create("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &memWriter{fsys, node}, nil
+}
+
+func (fsys *MemFS) WriteFile(name string, data []byte) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	node, err := fsys.create("open", name)
+	if err != nil {
+		return err
+	}
+	node.data = bytes.Clone(data)
+	return nil
+}
+
+func (fsys *MemFS) AppendFile(name string, data []byte) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if node, ok := fsys.nodes[name]; ok && !node.dir {
+		node.data = append(node.data, data...)
+		node.modTime = time.Now()
+		return nil
+	}
+	node, err := fsys.create("open", name)
+	if err != nil {
+		return err
+	}
+	node.data = bytes.Clone(data)
+	return nil
+}
+
+// create truncates the file name, creating it if needed.
+func (fsys *MemFS) create(op, name string) (*memNode, error) {
+	if err := fsys.checkParent(op, name); err != nil {
+		return nil, err
+	}
+	if node, ok := fsys.nodes[name]; ok {
+		if node.dir {
+			return nil, pathError(op, name, errIsDir)
+		}
+		node.data = nil
+		node.modTime = time.Now()
+		return node, nil
+	}
+	node := &memNode{modTime: time.Now()}
+	fsys.nodes[name] = node
+	return node, nil
+}
+
+func (fsys *MemFS) MkdirAll(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	if !fs.ValidPath(name) {
+		return pathError("mkdir", name, fs.ErrInvalid)
+	}
+	if name == "." {
+		return nil
+	}
+	dir := ""
+	for _, part := range strings.Split(name, "/") {
+		dir = path.Join(dir, part)
+		node, ok := fsys.nodes[dir]
+		if !ok {
+			fsys.nodes[dir] = &memNode{dir: true, modTime: time.Now()}
+		} else if !node.dir {
+			return pathError("mkdir", dir, errNotDir)
+		}
+	}
+	return nil
+}
+
+func (fsys *MemFS) Remove(name string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	node, err := fsys.lookup("remove", name)
+	if err != nil {
+		return err
+	}
+	if name == "." || (node.dir && len(fsys.readDir(name)) > 0) {
+		return pathError("remove", name, errDirNotEmpty)
+	}
+	delete(fsys.nodes, name)
+	return nil
+}
+
+func (fsys *MemFS) Rename(oldname, newname string) error {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	node, err := fsys.lookup("rename", oldname)
+	if err != nil {
+		return err
+	}
+	if err = fsys.checkParent("rename", newname); err != nil {
+		return err
+	}
+	if oldname == "." || strings.HasPrefix(newname, oldname+"/") {
+		return pathError("rename", oldname, fs.ErrInvalid)
+	}
+	if target, ok := fsys.nodes[newname]; ok && (target.dir || node.dir) {
+		return pathError("rename", newname, fs.ErrExist)
+	}
+	delete(fsys.nodes, oldname)
+	fsys.nodes[newname] = node
+	if node.dir {
+		for name, child := range fsys.nodes {
+			if strings.HasPrefix(name, oldname+"/") {
+				delete(fsys.nodes, name)
+				fsys.nodes[newname+strings.TrimPrefix(name, oldname)] = child
+			}
+		}
+	}
+	return nil
+}
+
+func (node *memNode) info(name string) fs.FileInfo {
+	return &memInfo{path.Base(name), node}
+}
+
+type memInfo struct {
+	name string
+	node *memNode
+}
+
+func (info *memInfo) Name() string       { return info.name }
+func (info *memInfo) Size() int64        { return int64(len(info.node.data)) }
+func (info *memInfo) ModTime() time.Time { return info.node.modTime }
+func (info *memInfo) IsDir() bool        { return info.node.dir }
+func (info *memInfo) Sys() any           { return nil }
+
+func (info *memInfo) Mode() fs.FileMode {
+	if info.node.dir {
+		return fs.ModeDir | 0777
+	}
+	return 0666
+}
+
+// memFile is an open MemFS file or directory; its contents are those at the time it was opened.
+type memFile struct {
+	*bytes.Reader
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (file *memFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+func (file *memFile) Close() error               { return nil }
+
+func (file *memFile) Read(p []byte) (int, error) {
+	if file.Reader == nil {
+		return 0, pathError("read", file.info.Name(), errIsDir)
+	}
+	return file.Reader.Read(p)
+}
+
+func (file *memFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if file.Reader != nil {
+		return nil, pathError("readdir", file.info.Name(), errNotDir)
+	}
+	if n <= 0 {
+		entries := file.entries
+		file.entries = nil
+		return entries, nil
+	}
+	if len(file.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(file.entries))
+	entries := file.entries[:n]
+	file.entries = file.entries[n:]
+	return entries, nil
+}
+
+type memWriter struct {
+	fsys *MemFS
+	node *memNode
+}
+
+func (writer *memWriter) Write(p []byte) (int, error) {
+	writer.fsys.mu.Lock()
+	defer writer.fsys.mu.Unlock()
+	writer.node.data = append(writer.node.data, p...)
+	writer.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (writer *memWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package svcs
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	writeFile(t, fsys, "a.txt", "a")
+	writeFile(t, fsys, "dir/sub/b.txt", "b")
+	if err := fsys.MkdirAll("empty"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "a.txt", "dir/sub/b.txt", "empty"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemFSErrors(t *testing.T) {
+	fsys := NewMemFS()
+	writeFile(t, fsys, "file", "data")
+	writeFile(t, fsys, "dir/a", "a")
+	tests := []struct {
+		name string
+		op   func() error
+		want error
+	}{
+		{"write without parent", func() error { return fsys.WriteFile("missing/a", nil) }, fs.ErrNotExist},
+		{"write below a file", func() error { return fsys.WriteFile("file/a", nil) }, errNotDir},
+		{"write a directory", func() error { return fsys.WriteFile("dir", nil) }, errIsDir},
+		{"append to a directory", func() error { return fsys.AppendFile("dir", nil) }, errIsDir},
+		{"read a directory", func() error { _, err := fsys.ReadFile("dir"); return err }, errIsDir},
+		{"invalid path", func() error { _, err := fsys.ReadFile("../a"); return err }, fs.ErrInvalid},
+		{"mkdir below a file", func() error { return fsys.MkdirAll("file/dir") }, errNotDir},
+		{"remove a full directory", func() error { return fsys.Remove("dir") }, errDirNotEmpty},
+		{"remove a missing file", func() error { return fsys.Remove("missing") }, fs.ErrNotExist},
+		{"rename into itself", func() error { return fsys.Rename("dir", "dir/sub") }, fs.ErrInvalid},
+	}
+	for _, tt := range tests {
+		err := tt.op()
+		var pathErr *fs.PathError
+		if !errors.Is(err, tt.want) || !errors.As(err, &pathErr) {
+			t.Errorf("%s: got %v, want a *fs.PathError for %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMemFSAppendFile(t *testing.T) {
+	fsys := NewMemFS()
+	for _, data := range []string{"a", "b"} {
+		if err := fsys.AppendFile("log", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readFile(t, fsys, "log"); got != "ab" {
+		t.Errorf("log = %q, want %q", got, "ab")
+	}
+}
+
+func TestMemFSRename(t *testing.T) {
+	fsys := NewMemFS()
+	writeFile(t, fsys, "dir/sub/a", "a")
+	if err := fsys.Rename("dir", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, fsys, "moved/sub/a"); got != "a" {
+		t.Errorf("moved/sub/a = %q", got)
+	}
+	if _, err := fsys.Stat("dir/sub"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("dir/sub still exists: %v", err)
+	}
+	writeFile(t, fsys, "b", "b")
+	if err := fsys.Rename("b", "moved/sub/a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, fsys, "moved/sub/a"); got != "b" {
+		t.Errorf("replaced file = %q, want %q", got, "b")
+	}
+}
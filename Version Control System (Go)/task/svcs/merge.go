@@ -0,0 +1,309 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Conflict markers around the two sides of a conflicting change.
+const (
+	conflictStart = "<<<<<<< "
+	conflictSep   = "=======\n"
+	conflictEnd   = ">>>>>>> "
+)
+
+// MergeLines merges the changes from base to ours and from base to theirs
+// line by line. Where both sides changed the same lines differently, it keeps
+// both between conflict markers labelled oursLabel and theirsLabel and reports
+// a conflict.
+func MergeLines(base, ours, theirs []byte, oursLabel, theirsLabel string) ([]byte, bool) {
+	b, o, t := SplitLines(base), SplitLines(ours), SplitLines(theirs)
+	inOurs, inTheirs := matchLines(b, o), matchLines(b, t)
+	var out strings.Builder
+	conflict := false
+	i, oi, ti := 0, 0, 0
+	for {
+		// The next base line that both sides kept ends a chunk
+		j := i
+		for j < len(b) && (inOurs[j] < 0 || inTheirs[j] < 0) {
+			j++
+		}
+		oj, tj := len(o), len(t)
+		if j < len(b) {
+			oj, tj = inOurs[j], inTheirs[j]
+		}
+		baseChunk, oursChunk, theirsChunk := b[i:j], o[oi:oj], t[ti:tj]
+		switch {
+		case slices.Equal(oursChunk, baseChunk) || slices.Equal(oursChunk, theirsChunk):
+			writeLines(&out, theirsChunk)
+		case slices.Equal(theirsChunk, baseChunk):
+			writeLines(&out, oursChunk)
+		default:
+			conflict = true
+			out.WriteString(conflictStart + oursLabel + "\n")
+			writeLines(&out, oursChunk)
+			endLine(&out)
+			out.WriteString(conflictSep)
+			writeLines(&out, theirsChunk)
+			endLine(&out)
+			out.WriteString(conflictEnd + theirsLabel + "\n")
+		}
+		if j == len(b) {
+			return []byte(out.String()), conflict
+		}
+		out.WriteString(b[j])
+		i, oi, ti = j+1, oj+1, tj+1
+	}
+}
+
+// matchLines returns, for every line of a, the index of the same line in b
+// according to DiffLines, or -1 if it was deleted.
+func matchLines(a, b []string) []int {
+	at := make([]int, len(a))
+	for i := range at {
+		at[i] = -1
+	}
+	for _, edit := range DiffLines(a, b) {
+		if edit.Op == OpEqual {
+			at[edit.OldLine] = edit.NewLine
+		}
+	}
+	return at
+}
+
+func writeLines(out *strings.Builder, lines []string) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+}
+
+// endLine ends the last line written to out if it lacks a newline.
+func endLine(out *strings.Builder) {
+	if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		out.WriteString("\n")
+	}
+}
+
+// hasConflictMarkers reports whether data has a line that starts a conflict.
+func hasConflictMarkers(data []byte) bool {
+	for _, line := range SplitLines(data) {
+		if strings.HasPrefix(line, conflictStart) || strings.HasPrefix(line, conflictEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedFile is the outcome of a three-way merge for one file.
+type mergedFile struct {
+	path string
+	// staged is the object to stage, "" to remove the file from the index.
+	staged string
+	// data, if set, is written to the work tree; otherwise the work tree gets
+	// the object work, or loses the file if work is "".
+	data []byte
+	work string
+	// conflict is set when both sides changed the file in ways that don't combine.
+	conflict bool
+}
+
+// mergeSnapshots merges the changes from base to theirs into ours, which is
+// the index, file by file and, for text files changed on both sides, line by
+// line. It returns the files that change.
+func (repo *Repository) mergeSnapshots(base, ours, theirs snapshot, oursLabel, theirsLabel string) ([]mergedFile, error) {
+	var names []string
+	for _, snap := range []snapshot{base, ours, theirs} {
+		for _, entry := range snap.Files {
+			names = append(names, entry.Path)
+		}
+	}
+	sort.Strings(names)
+	var files []mergedFile
+	for i, name := range names {
+		if i > 0 && names[i-1] == name {
+			continue
+		}
+		b, o, t := base.lookup(name), ours.lookup(name), theirs.lookup(name)
+		switch {
+		case o == t || t == b:
+		case o == b:
+			files = append(files, mergedFile{path: name, staged: t, work: t})
+		case o == "":
+			// Deleted on our side, changed on theirs: leave their version to decide on
+			files = append(files, mergedFile{path: name, work: t, conflict: true})
+		case t == "":
+			files = append(files, mergedFile{path: name, staged: o, work: o, conflict: true})
+		default:
+			file, err := repo.mergeFile(name, b, o, t, oursLabel, theirsLabel)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// mergeFile merges the objects b, which may be "", o and t of the file name line
+// by line. Large and binary files conflict, keeping our side.
+func (repo *Repository) mergeFile(name, b, o, t, oursLabel, theirsLabel string) (mergedFile, error) {
+	var contents [3][]byte
+	for side, id := range []string{b, o, t} {
+		if id == "" {
+			continue
+		}
+		kind, data, err := repo.readFile(id)
+		if err != nil {
+			return mergedFile{}, err
+		}
+		if kind == ObjectPointer || IsBinary(data) {
+			return mergedFile{path: name, staged: o, work: o, conflict: true}, nil
+		}
+		contents[side] = data
+	}
+	merged, conflict := MergeLines(contents[0], contents[1], contents[2], oursLabel, theirsLabel)
+	if conflict {
+		return mergedFile{path: name, staged: o, data: merged, conflict: true}, nil
+	}
+	id, err := repo.writeObject(ObjectBlob, merged)
+	if err != nil {
+		return mergedFile{}, err
+	}
+	return mergedFile{path: name, staged: id, data: merged}, nil
+}
+
+// applyMerge writes the merged files to the work tree and the index, and
+// returns the paths that conflict. It refuses to overwrite untracked files.
+func (repo *Repository) applyMerge(files []mergedFile) ([]string, error) {
+	for _, file := range files {
+		if repo.index.lookup(file.path) != "" || (file.data == nil && file.work == "") {
+			continue
+		}
+		// An untracked file that already has the incoming contents is kept
+		state, err := repo.workState(file.path, file.work)
+		if err != nil {
+			return nil, err
+		}
+		if state != StateDeleted && (file.data != nil || state != StateUnmodified) {
+			return nil, NewError(ErrConflict, "the untracked file '%s' would be overwritten", file.path)
+		}
+	}
+	conflicts := []string{}
+	for _, file := range files {
+		if dir := path.Dir(file.path); dir != "." && (file.data != nil || file.work != "") {
+			if err := repo.work.MkdirAll(dir); err != nil {
+				return nil, ioError(err)
+			}
+		}
+		var err error
+		switch {
+		case file.data != nil:
+			err = ioError(repo.work.WriteFile(file.path, file.data))
+		case file.work != "":
+			err = repo.writeWorkFile(file.path, file.work)
+		default:
+			if err = repo.work.Remove(file.path); errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+			err = ioError(err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		repo.index.set(file.path, file.staged)
+		if file.conflict {
+			conflicts = append(conflicts, file.path)
+		}
+	}
+	return conflicts, repo.writeIndex()
+}
+
+// requireClean fails if the index or a tracked file of the work tree differs
+// from the current commit, as operations that rewrite them would lose the changes.
+func (repo *Repository) requireClean(operation string) error {
+	statuses, err := repo.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if (status.Staged != StateUnmodified && status.Staged != StateUntracked) ||
+			status.Unstaged == StateModified || status.Unstaged == StateDeleted {
+			return NewError(ErrConflict, "'%s' has local changes, commit them before %s", status.Path, operation)
+		}
+	}
+	return nil
+}
+
+// checkResolved fails unless every file of conflicts has been resolved and
+// staged: its work tree contents are staged and free of conflict markers.
+func (repo *Repository) checkResolved(conflicts []string) error {
+	for _, name := range conflicts {
+		staged := repo.index.lookup(name)
+		state, err := repo.workState(name, staged)
+		if err != nil {
+			return err
+		}
+		if state != StateUnmodified {
+			return NewError(ErrConflict, "'%s' is not staged, add it once resolved", name)
+		}
+		if staged == "" {
+			continue
+		}
+		kind, data, err := repo.readFile(staged)
+		if err != nil {
+			return err
+		}
+		if kind == ObjectBlob && hasConflictMarkers(data) {
+			return NewError(ErrConflict, "'%s' still has conflict markers", name)
+		}
+	}
+	return nil
+}
+
+// resetTo makes commit the current one, moving the current branch unless
+// it is already there, with the index and the tracked files of the work tree
+// as of it. Tracked files, and the files of extra, that commit does not have
+// are removed.
+func (repo *Repository) resetTo(commit *Commit, extra []string, command string) error {
+	snap, err := repo.readTree(commit.Tree)
+	if err != nil {
+		return err
+	}
+	var remove []string
+	for _, entry := range repo.index.Files {
+		remove = append(remove, entry.Path)
+	}
+	for _, name := range append(remove, extra...) {
+		if snap.lookup(name) != "" {
+			continue
+		}
+		if err = repo.work.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return ioError(err)
+		}
+	}
+	for _, entry := range snap.Files {
+		if dir := path.Dir(entry.Path); dir != "." {
+			if err = repo.work.MkdirAll(dir); err != nil {
+				return ioError(err)
+			}
+		}
+		if err = repo.writeWorkFile(entry.Path, entry.Object); err != nil {
+			return err
+		}
+	}
+	repo.index = snap
+	if err = repo.writeIndex(); err != nil || commit.Hash == repo.head {
+		return err
+	}
+	return repo.moveHead(commit.Hash, command)
+}
+
+// pickLabel is how conflict markers name the side of commit.
+func pickLabel(commit *Commit) string {
+	return fmt.Sprintf("%s (%s)", commit.Hash, commit.Subject())
+}
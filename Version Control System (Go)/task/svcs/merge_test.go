@@ -0,0 +1,40 @@
+package svcs
+
+import "testing"
+
+func TestMergeLines(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflict           bool
+	}{
+		{"unchanged", "a\nb\n", "a\nb\n", "a\nb\n", "a\nb\n", false},
+		{"ours only", "a\nb\n", "A\nb\n", "a\nb\n", "A\nb\n", false},
+		{"theirs only", "a\nb\n", "a\nb\n", "a\nB\n", "a\nB\n", false},
+		{"both", "1\n2\n3\n4\n5\n", "one\n2\n3\n4\n5\n", "1\n2\n3\n4\nfive\n", "one\n2\n3\n4\nfive\n", false},
+		{"same change", "a\nb\n", "a\nB\n", "a\nB\n", "a\nB\n", false},
+		{"insert and delete", "a\nb\nc\n", "a\nc\n", "a\nb\nc\nd\n", "a\nc\nd\n", false},
+		{"from nothing", "", "a\n", "", "a\n", false},
+		{
+			"conflict", "a\nb\nc\n", "a\nours\nc\n", "a\ntheirs\nc\n",
+			"a\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> pick\nc\n", true,
+		},
+		{
+			"conflict without newline", "a", "b", "c",
+			"<<<<<<< HEAD\nb\n=======\nc\n>>>>>>> pick\n", true,
+		},
+		{
+			"added on both sides", "", "x\n", "y\n",
+			"<<<<<<< HEAD\nx\n=======\ny\n>>>>>>> pick\n", true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := MergeLines([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), "HEAD", "pick")
+			if string(got) != tt.want || conflict != tt.conflict {
+				t.Errorf("MergeLines() = %q, %v, want %q, %v", got, conflict, tt.want, tt.conflict)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package svcs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const objectsDir = "objects"
+
+// Object types. An object is encoded as "<type> <size>\x00" followed by its
+// contents, and identified by a hash of that encoding, which is stored
+// compressed with zlib. A tree refers to the contents of each file through a
+// blob, or a pointer to a file of the large-object area.
+const (
+	ObjectBlob    = "blob"
+	ObjectTree    = "tree"
+	ObjectCommit  = "commit"
+	ObjectPointer = "pointer"
+)
+
+// idLength is the number of hex digits of an object id: the first 16 bytes of a SHA-256.
+const idLength = 32
+
+// ValidID reports whether id has the form of an object id.
+func ValidID(id string) bool {
+	return len(id) == idLength && strings.Trim(id, "0123456789abcdef") == ""
+}
+
+func objectPath(id string) string {
+	return path.Join(objectsDir, id[:2], id[2:])
+}
+
+// encodeObject returns the stored form of an object and its id.
+func encodeObject(kind string, data []byte) (string, []byte) {
+	encoded := append([]byte(fmt.Sprintf("%s %d\x00", kind, len(data))), data...)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:idLength/2]), encoded
+}
+
+// decodeObject splits the stored form of an object, read from the file name,
+// into its type and contents.
+func decodeObject(name string, encoded []byte) (string, []byte, error) {
+	header, data, ok := bytes.Cut(encoded, []byte{0})
+	if !ok {
+		return "", nil, corruptError(name, "missing object header")
+	}
+	kind, size, _ := bytes.Cut(header, []byte{' '})
+	n, err := strconv.Atoi(string(size))
+	if err != nil || n != len(data) {
+		return "", nil, corruptError(name, "object size does not match its header")
+	}
+	switch string(kind) {
+	case ObjectBlob, ObjectTree, ObjectCommit, ObjectPointer:
+		return string(kind), data, nil
+	}
+	return "", nil, corruptError(name, "unknown object type '%s'", kind)
+}
+
+// writeObject stores an object unless it already exists and returns its id.
+func (repo *Repository) writeObject(kind string, data []byte) (string, error) {
+	id, encoded := encodeObject(kind, data)
+	if ok, err := repo.hasObject(id); ok || err != nil {
+		return id, err
+	}
+	name := objectPath(id)
+	if err := repo.store.MkdirAll(path.Dir(name)); err != nil {
+		return "", ioError(err)
+	}
+	// Objects appear complete or not at all
+	if err := repo.store.WriteFile(name+".tmp", compress(encoded)); err != nil {
+		return "", ioError(err)
+	}
+	return id, ioError(repo.store.Rename(name+".tmp", name))
+}
+
+// hasObject reports whether the object id is stored, loose or packed.
+func (repo *Repository) hasObject(id string) (bool, error) {
+	if _, err := repo.store.Stat(objectPath(id)); err == nil {
+		return true, nil
+	}
+	_, _, err := repo.findPacked(id)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// objectIDs returns the ids of the objects, loose or packed, that start with
+// prefix, which has at least two hex digits.
+func (repo *Repository) objectIDs(prefix string) ([]string, error) {
+	var ids []string
+	entries, err := repo.store.ReadDir(path.Join(objectsDir, prefix[:2]))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, ioError(err)
+	}
+	for _, entry := range entries {
+		if id := prefix[:2] + entry.Name(); ValidID(id) && strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	packs, err := repo.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].id >= prefix })
+		for ; i < len(p.entries) && strings.HasPrefix(p.entries[i].id, prefix); i++ {
+			ids = append(ids, p.entries[i].id)
+		}
+	}
+	sort.Strings(ids)
+	return slices.Compact(ids), nil
+}
+
+// readEncoded returns the stored form of the object id, loose or packed, and
+// the name of the file it was read from. It fails with fs.ErrNotExist if
+// there is no such object.
+func (repo *Repository) readEncoded(id string) (string, []byte, error) {
+	name := objectPath(id)
+	encoded, err := readLoose(repo.store, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return repo.readPacked(id)
+	}
+	return name, encoded, err
+}
+
+// readLoose returns the encoded object stored in the file name.
+func readLoose(store FS, name string) ([]byte, error) {
+	data, err := store.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ioError(err)
+	}
+	return decompress(name, data)
+}
+
+func compress(data []byte) []byte {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	// Writing to a bytes.Buffer does not fail
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+// decompress returns the data compressed with zlib read from the file name.
+func decompress(name string, data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, corruptError(name, "%v", err)
+	}
+	data, err = io.ReadAll(reader)
+	if err != nil {
+		return nil, corruptError(name, "%v", err)
+	}
+	return data, nil
+}
+
+// readObject returns the contents of the object id, which must be of type kind.
+func (repo *Repository) readObject(id, kind string) ([]byte, error) {
+	if !ValidID(id) {
+		return nil, NewError(ErrUnknownRevision, "bad object id '%s'", id)
+	}
+	name, encoded, err := repo.readEncoded(id)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, corruptError(objectPath(id), "missing %s object", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	actual, data, err := decodeObject(name, encoded)
+	if err != nil {
+		return nil, err
+	}
+	if actual != kind {
+		return nil, corruptError(name, "expected a %s object, found a %s", kind, actual)
+	}
+	return data, nil
+}
+
+// TreeEntry is a file of a snapshot: its path in the work tree and the blob
+// of its contents, or a pointer to them.
+type TreeEntry struct {
+	Path   string `json:"path"`
+	Object string `json:"object"`
+}
+
+// snapshot is the list of files of a tree object or of the index, sorted by path.
+type snapshot struct {
+	Files []TreeEntry `json:"files"`
+}
+
+func (snap *snapshot) validate(name string) error {
+	for i, entry := range snap.Files {
+		if clean, err := CleanPath(entry.Path); err != nil || clean != entry.Path || clean == "." {
+			return corruptError(name, "bad path '%s'", entry.Path)
+		}
+		if !ValidID(entry.Object) {
+			return corruptError(name, "bad object id '%s' for '%s'", entry.Object, entry.Path)
+		}
+		if i > 0 && snap.Files[i-1].Path >= entry.Path {
+			return corruptError(name, "paths are not sorted and unique at '%s'", entry.Path)
+		}
+	}
+	return nil
+}
+
+// lookup returns the blob of the file name, or "".
+func (snap *snapshot) lookup(name string) string {
+	i := sort.Search(len(snap.Files), func(i int) bool { return snap.Files[i].Path >= name })
+	if i < len(snap.Files) && snap.Files[i].Path == name {
+		return snap.Files[i].Object
+	}
+	return ""
+}
+
+// set records object as the blob of the file name; an empty object removes it.
+func (snap *snapshot) set(name, object string) {
+	i := sort.Search(len(snap.Files), func(i int) bool { return snap.Files[i].Path >= name })
+	found := i < len(snap.Files) && snap.Files[i].Path == name
+	switch {
+	case found && object == "":
+		snap.Files = append(snap.Files[:i], snap.Files[i+1:]...)
+	case found:
+		snap.Files[i].Object = object
+	case object != "":
+		snap.Files = append(snap.Files, TreeEntry{})
+		copy(snap.Files[i+1:], snap.Files[i:])
+		snap.Files[i] = TreeEntry{name, object}
+	}
+}
+
+func (repo *Repository) writeTree(snap snapshot) (string, error) {
+	if snap.Files == nil {
+		snap.Files = []TreeEntry{}
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return "", err
+	}
+	return repo.writeObject(ObjectTree, data)
+}
+
+func (repo *Repository) readTree(id string) (snapshot, error) {
+	data, err := repo.readObject(id, ObjectTree)
+	if err != nil {
+		return snapshot{}, err
+	}
+	return decodeTree(id, data)
+}
+
+// decodeTree parses the contents of the tree object id.
+func decodeTree(id string, data []byte) (snapshot, error) {
+	var snap snapshot
+	if err := decodeStrict(objectPath(id), data, &snap); err != nil {
+		return snap, err
+	}
+	return snap, snap.validate(objectPath(id))
+}
+
+// Commit is a snapshot of the tracked files together with its history and description.
+type Commit struct {
+	Hash    string    `json:"hash"`
+	Tree    string    `json:"tree"`
+	Parents []string  `json:"parents"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email,omitempty"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+// Subject returns the first line of the message of commit.
+func (commit *Commit) Subject() string {
+	line, _, _ := strings.Cut(commit.Message, "\n")
+	return line
+}
+
+// commitObject is the stored form of a Commit, which is identified by the hash of it.
+type commitObject struct {
+	Tree    string    `json:"tree"`
+	Parents []string  `json:"parents"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email,omitempty"`
+	Date    time.Time `json:"date"`
+	Message string    `json:"message"`
+}
+
+func (repo *Repository) writeCommit(commit *Commit) error {
+	parents := commit.Parents
+	if parents == nil {
+		parents = []string{}
+	}
+	data, err := json.Marshal(commitObject{commit.Tree, parents, commit.Author, commit.Email, commit.Date, commit.Message})
+	if err != nil {
+		return err
+	}
+	commit.Hash, err = repo.writeObject(ObjectCommit, data)
+	return err
+}
+
+// ReadCommit returns the commit with the full id hash.
+func (repo *Repository) ReadCommit(hash string) (*Commit, error) {
+	data, err := repo.readObject(hash, ObjectCommit)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCommit(hash, data)
+}
+
+// decodeCommit parses the contents of the commit object hash.
+func decodeCommit(hash string, data []byte) (*Commit, error) {
+	var object commitObject
+	name := objectPath(hash)
+	if err := decodeStrict(name, data, &object); err != nil {
+		return nil, err
+	}
+	if !ValidID(object.Tree) {
+		return nil, corruptError(name, "bad tree id '%s'", object.Tree)
+	}
+	for _, parent := range object.Parents {
+		if !ValidID(parent) {
+			return nil, corruptError(name, "bad parent id '%s'", parent)
+		}
+	}
+	if object.Date.IsZero() {
+		return nil, corruptError(name, "missing date")
+	}
+	return &Commit{hash, object.Tree, object.Parents, object.Author, object.Email, object.Date, object.Message}, nil
+}
+
+// decodeStrict decodes the JSON data read from name into v, rejecting
+// unknown fields and trailing data.
+func decodeStrict(name string, data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return corruptError(name, "%v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return corruptError(name, "unexpected data after the JSON value")
+	}
+	return nil
+}
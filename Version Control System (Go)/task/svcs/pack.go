@@ -0,0 +1,383 @@
+package svcs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A pack holds many objects in one file, objects/pack/pack-<id>.pack: a
+// header line followed by a record for each object. A record is packFull
+// and the compressed encoding of the object, or packDelta, the 16 bytes of
+// the id of another object of the pack and a compressed delta that rebuilds the object from
+// it. The index, pack-<id>.idx, has a header line and then for each record,
+// sorted by object id, the 16 bytes of the id, its offset as 8 bytes and its
+// size as 4, big-endian. It is written last, so a pack without one is
+// incomplete and ignored.
+const (
+	packDir         = "objects/pack"
+	packPrefix      = "pack-"
+	packHeader      = "SVCSPACK 1\n"
+	packIndexHeader = "SVCSIDX 1\n"
+	// packIndexEntrySize is the size of the index entry of a record
+	packIndexEntrySize = idLength/2 + 8 + 4
+	packFull           = 0
+	packDelta          = 1
+	// deltaWindow is how many similar objects writePack tries as delta bases.
+	deltaWindow = 10
+	// maxDeltaDepth is the longest chain of deltas to rebuild an object from.
+	maxDeltaDepth = 10
+)
+
+// pack is a pack file as described by its index.
+type pack struct {
+	// name is the path of the pack file without its extension
+	name    string
+	entries []packEntry
+	modTime time.Time
+	// size is the size of the pack file
+	size int64
+}
+
+type packEntry struct {
+	id     string
+	offset int64
+	size   int64
+}
+
+// packObject is an object to write to a pack.
+type packObject struct {
+	id      string
+	encoded []byte
+	// hint is the path of a file with this content, if it is a blob
+	hint string
+}
+
+func (p *pack) lookup(id string) (packEntry, bool) {
+	i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].id >= id })
+	if i < len(p.entries) && p.entries[i].id == id {
+		return p.entries[i], true
+	}
+	return packEntry{}, false
+}
+
+// loadPacks reads the indexes of all packs, once.
+func (repo *Repository) loadPacks() ([]*pack, error) {
+	if repo.packsLoaded {
+		return repo.packs, nil
+	}
+	entries, err := repo.store.ReadDir(packDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, ioError(err)
+	}
+	var packs []*pack
+	for _, entry := range entries {
+		base, ok := strings.CutSuffix(entry.Name(), ".idx")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		p, err := readPackIndex(repo.store, path.Join(packDir, base))
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, p)
+	}
+	repo.packs, repo.packsLoaded = packs, true
+	return packs, nil
+}
+
+// readPackIndex reads the index of the pack name, given without extension.
+func readPackIndex(store FS, name string) (*pack, error) {
+	p, data, err := openPackIndex(store, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%packIndexEntrySize != 0 {
+		return nil, corruptError(name+".idx", "truncated")
+	}
+	for ; len(data) > 0; data = data[packIndexEntrySize:] {
+		entry := packEntry{
+			id:     hex.EncodeToString(data[:idLength/2]),
+			offset: int64(binary.BigEndian.Uint64(data[idLength/2:])),
+			size:   int64(binary.BigEndian.Uint32(data[idLength/2+8:])),
+		}
+		if err = p.add(entry); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// openPackIndex reads the index of the pack name and returns the pack
+// without entries and the rest of the index, after the header.
+func openPackIndex(store FS, name string) (*pack, []byte, error) {
+	data, err := store.ReadFile(name + ".idx")
+	if err != nil {
+		return nil, nil, ioError(err)
+	}
+	info, err := store.Stat(name + ".pack")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, corruptError(name+".idx", "the pack file is missing")
+	}
+	if err != nil {
+		return nil, nil, ioError(err)
+	}
+	rest, ok := bytes.CutPrefix(data, []byte(packIndexHeader))
+	if !ok {
+		return nil, nil, corruptError(name+".idx", "bad header")
+	}
+	return &pack{name: name, modTime: info.ModTime(), size: info.Size()}, rest, nil
+}
+
+// add appends entry to the entries of p, which are sorted by id.
+func (p *pack) add(entry packEntry) error {
+	if entry.offset < int64(len(packHeader)) || entry.size < 0 || entry.offset+entry.size > p.size || entry.offset+entry.size < 0 {
+		return corruptError(p.name+".idx", "bad offset or size for %s", entry.id)
+	}
+	if n := len(p.entries); n > 0 && p.entries[n-1].id >= entry.id {
+		return corruptError(p.name+".idx", "entries are not sorted and unique at %s", entry.id)
+	}
+	p.entries = append(p.entries, entry)
+	return nil
+}
+
+// findPacked returns the pack holding the object id, failing with
+// fs.ErrNotExist if there is none.
+func (repo *Repository) findPacked(id string) (*pack, packEntry, error) {
+	packs, err := repo.loadPacks()
+	if err != nil {
+		return nil, packEntry{}, err
+	}
+	for _, p := range packs {
+		if entry, ok := p.lookup(id); ok {
+			return p, entry, nil
+		}
+	}
+	return nil, packEntry{}, fs.ErrNotExist
+}
+
+// readPacked returns the encoding of the packed object id and the name of its pack.
+func (repo *Repository) readPacked(id string) (string, []byte, error) {
+	p, entry, err := repo.findPacked(id)
+	if err != nil {
+		return "", nil, err
+	}
+	encoded, err := repo.readPackEntry(p, entry, 0)
+	return p.name + ".pack", encoded, err
+}
+
+// readPackEntry returns the encoding of the object of entry in p, rebuilding
+// it from depth deltas at most.
+func (repo *Repository) readPackEntry(p *pack, entry packEntry, depth int) ([]byte, error) {
+	name := p.name + ".pack"
+	record, err := readRange(repo.store, name, entry.offset, entry.size)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(record) > 0 && record[0] == packFull:
+		return decompress(name, record[1:])
+	case len(record) <= 1+idLength/2 || record[0] != packDelta:
+		return nil, corruptError(name, "bad record for %s", entry.id)
+	case depth >= maxDeltaDepth:
+		return nil, corruptError(name, "the deltas of %s are nested too deep", entry.id)
+	}
+	baseEntry, ok := p.lookup(hex.EncodeToString(record[1 : 1+idLength/2]))
+	if !ok {
+		return nil, corruptError(name, "the delta base of %s is missing", entry.id)
+	}
+	base, err := repo.readPackEntry(p, baseEntry, depth+1)
+	if err != nil {
+		return nil, err
+	}
+	delta, err := decompress(name, record[1+idLength/2:])
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := applyDelta(base, delta)
+	if err != nil {
+		return nil, corruptError(name, "%v for %s", err, entry.id)
+	}
+	return encoded, nil
+}
+
+// readRange reads size bytes at offset of the file name, without reading
+// the whole file when the filesystem allows it.
+func readRange(fsys FS, name string, offset, size int64) ([]byte, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	defer file.Close()
+	data := make([]byte, size)
+	if reader, ok := file.(io.ReaderAt); ok {
+		if _, err = reader.ReadAt(data, offset); errors.Is(err, io.EOF) {
+			return nil, corruptError(name, "truncated at offset %d", offset)
+		}
+		return data, ioError(err)
+	}
+	all, err := io.ReadAll(file)
+	if err != nil {
+		return nil, ioError(err)
+	}
+	if offset+size > int64(len(all)) {
+		return nil, corruptError(name, "truncated at offset %d", offset)
+	}
+	return all[offset : offset+size], nil
+}
+
+// writePack stores objects in a new pack and returns its name without extension.
+func (repo *Repository) writePack(objects []packObject) (string, error) {
+	records := packRecords(objects)
+	sort.Slice(objects, func(i, j int) bool { return objects[i].id < objects[j].id })
+	var data, index bytes.Buffer
+	data.WriteString(packHeader)
+	index.WriteString(packIndexHeader)
+	ids := sha256.New()
+	for _, object := range objects {
+		id, _ := hex.DecodeString(object.id)
+		index.Write(id)
+		index.Write(binary.BigEndian.AppendUint64(nil, uint64(data.Len())))
+		index.Write(binary.BigEndian.AppendUint32(nil, uint32(len(records[object.id]))))
+		data.Write(records[object.id])
+		ids.Write([]byte(object.id))
+	}
+	// Packs are named after the objects they hold
+	name := path.Join(packDir, packPrefix+hex.EncodeToString(ids.Sum(nil)[:idLength/2]))
+	if err := repo.store.MkdirAll(packDir); err != nil {
+		return "", ioError(err)
+	}
+	for _, file := range []struct {
+		ext  string
+		data []byte
+	}{{".pack", data.Bytes()}, {".idx", index.Bytes()}} {
+		if err := repo.store.WriteFile(name+file.ext+".tmp", file.data); err != nil {
+			return "", ioError(err)
+		}
+		if err := repo.store.Rename(name+file.ext+".tmp", name+file.ext); err != nil {
+			return "", ioError(err)
+		}
+	}
+	repo.packsLoaded = false
+	return name, nil
+}
+
+// packRecords returns the pack record of each object, by id: a delta against
+// one of the objects most like it if that is smaller than the object itself.
+func packRecords(objects []packObject) map[string][]byte {
+	// Objects of the same type and path are likely alike; the larger, often
+	// newer, ones come first so that the deltas remove data
+	order := slices.Clone(objects)
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if kindA, kindB := objectKind(a.encoded), objectKind(b.encoded); kindA != kindB {
+			return kindA < kindB
+		}
+		if a.hint != b.hint {
+			return a.hint < b.hint
+		}
+		if len(a.encoded) != len(b.encoded) {
+			return len(a.encoded) > len(b.encoded)
+		}
+		return a.id < b.id
+	})
+	records := make(map[string][]byte, len(order))
+	depths := map[string]int{}
+	for i, object := range order {
+		best := append([]byte{packFull}, compress(object.encoded)...)
+		for _, base := range order[max(0, i-deltaWindow):i] {
+			if objectKind(base.encoded) != objectKind(object.encoded) || depths[base.id] >= maxDeltaDepth {
+				continue
+			}
+			delta := makeDelta(base.encoded, object.encoded)
+			if 1+idLength/2+len(delta) >= len(best) {
+				continue
+			}
+			if delta = compress(delta); 1+idLength/2+len(delta) < len(best) {
+				id, _ := hex.DecodeString(base.id)
+				best = append(append([]byte{packDelta}, id...), delta...)
+				depths[object.id] = depths[base.id] + 1
+			}
+		}
+		records[object.id] = best
+	}
+	return records
+}
+
+// objectKind returns the type of an encoded object.
+func objectKind(encoded []byte) string {
+	kind, _, _ := bytes.Cut(encoded, []byte{' '})
+	return string(kind)
+}
+
+// ObjectCounts describes how the objects are stored.
+type ObjectCounts struct {
+	Loose int `json:"loose"`
+	// LooseSize is the disk space used by loose objects, in bytes.
+	LooseSize int64 `json:"looseSize"`
+	Packs     int   `json:"packs"`
+	Packed    int   `json:"packed"`
+	// Deltas is the number of packed objects stored as deltas.
+	Deltas int `json:"deltas"`
+	// PackSize is the disk space used by packs and their indexes, in bytes.
+	PackSize int64 `json:"packSize"`
+	// Size is the total size of the objects, uncompressed.
+	Size int64 `json:"size"`
+}
+
+// CountObjects reports the number of objects and the space they use.
+func (repo *Repository) CountObjects() (*ObjectCounts, error) {
+	counts := &ObjectCounts{}
+	loose, _, err := repo.looseObjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range loose {
+		encoded, err := readLoose(repo.store, objectPath(object.id))
+		if err != nil {
+			return nil, err
+		}
+		counts.Loose++
+		counts.LooseSize += object.size
+		counts.Size += int64(len(encoded))
+	}
+	packs, err := repo.loadPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		counts.Packs++
+		for _, ext := range []string{".pack", ".idx"} {
+			info, err := repo.store.Stat(p.name + ext)
+			if err != nil {
+				return nil, ioError(err)
+			}
+			counts.PackSize += info.Size()
+		}
+		for _, entry := range p.entries {
+			encoded, err := repo.readPackEntry(p, entry, 0)
+			if err != nil {
+				return nil, err
+			}
+			kind, err := readRange(repo.store, p.name+".pack", entry.offset, 1)
+			if err != nil {
+				return nil, err
+			}
+			counts.Packed++
+			if kind[0] == packDelta {
+				counts.Deltas++
+			}
+			counts.Size += int64(len(encoded))
+		}
+	}
+	return counts, nil
+}
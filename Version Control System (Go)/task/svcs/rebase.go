@@ -0,0 +1,475 @@
+package svcs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"unicode"
+)
+
+// rebaseFilename holds the state of a rebase stopped by conflicts.
+const rebaseFilename = "rebase.txt"
+
+// Rebase actions, what a step of a plan does with its commit.
+const (
+	// RebasePick applies the changes of the commit as a new commit.
+	RebasePick = "pick"
+	// RebaseReword picks the commit with the message of the step.
+	RebaseReword = "reword"
+	// RebaseSquash melds the changes of the commit into the previous one and
+	// appends its message to that commit's.
+	RebaseSquash = "squash"
+	// RebaseFixup melds the changes of the commit into the previous one,
+	// keeping that commit's message.
+	RebaseFixup = "fixup"
+	// RebaseDrop leaves the commit out.
+	RebaseDrop = "drop"
+)
+
+// rebaseActions maps the actions of a plan, and their one-letter
+// abbreviations, to the actions.
+var rebaseActions = map[string]string{
+	RebasePick: RebasePick, "p": RebasePick,
+	RebaseReword: RebaseReword, "r": RebaseReword,
+	RebaseSquash: RebaseSquash, "s": RebaseSquash,
+	RebaseFixup: RebaseFixup, "f": RebaseFixup,
+	RebaseDrop: RebaseDrop, "d": RebaseDrop,
+}
+
+var errNotRebasing = errors.New("no rebase in progress")
+
+// RebaseStep is a step of a rebase plan.
+type RebaseStep struct {
+	Action string `json:"action"`
+	Commit string `json:"commit"`
+	// Message is the new message of a RebaseReword step.
+	Message string `json:"message,omitempty"`
+}
+
+// rebaseState is the contents of rebase.txt.
+type rebaseState struct {
+	// Head is the commit that was current when the rebase started.
+	Head string `json:"head"`
+	// Branch is the branch being rebased, or "" if HEAD was detached; it
+	// stays at Head until the rebase finishes.
+	Branch string `json:"branch,omitempty"`
+	Onto   string `json:"onto"`
+	// Todo lists the steps left, starting with the one that stopped.
+	Todo      []RebaseStep `json:"todo"`
+	Conflicts []string     `json:"conflicts"`
+}
+
+// RebaseResult is the outcome of a rebase. Stopped is the commit of the step
+// whose changes conflict, if any; once they are resolved and staged,
+// RebaseContinue commits them and carries out the rest of the plan.
+type RebaseResult struct {
+	CherryPickResult
+	// Onto is the commit the steps are replayed on.
+	Onto *Commit
+	// UpToDate is set when there was nothing to replay: the current commit
+	// already descends from Onto.
+	UpToDate bool
+}
+
+// ParseRebasePlan parses a rebase plan: one "<action> <commit>" step per
+// line, the action being pick, reword, squash, fixup or drop or its first
+// letter. The rest of a reword line is the new message and is ignored
+// otherwise. Blank lines and lines starting with "#" are skipped.
+func ParseRebasePlan(text string) ([]RebaseStep, error) {
+	steps := []RebaseStep{}
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		action, ok := rebaseActions[fields[0]]
+		if !ok {
+			return nil, fmt.Errorf("plan line %d: unknown action '%s'", i+1, fields[0])
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("plan line %d: missing commit", i+1)
+		}
+		step := RebaseStep{Action: action, Commit: fields[1]}
+		if action == RebaseReword {
+			if step.Message = skipFields(line, 2); step.Message == "" {
+				return nil, fmt.Errorf("plan line %d: reword needs the new message", i+1)
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// skipFields returns what follows the first n fields of line, trimmed.
+func skipFields(line string, n int) string {
+	for range n {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		i := strings.IndexFunc(line, unicode.IsSpace)
+		if i < 0 {
+			return ""
+		}
+		line = line[i:]
+	}
+	return strings.TrimSpace(line)
+}
+
+// Rebase replays commits on top of the revision upstream: by default the
+// commits that the current one leads to and upstream does not, oldest first,
+// as RebasePick steps, or else the steps of plan. Without upstream, a plan is
+// replayed on the parent of its first commit. Each step applies the changes
+// of its commit as CherryPick does, keeping the original author and date.
+// HEAD is detached while the steps are replayed, and the current branch, if
+// any, moves to the result once they are all done. The index and the tracked
+// files must not have changes.
+func (repo *Repository) Rebase(upstream string, plan []RebaseStep) (*RebaseResult, error) {
+	if err := repo.checkNoSequence(); err != nil {
+		return nil, err
+	}
+	if repo.head == "" {
+		return nil, NewError(ErrUnknownRevision, "there are no commits yet")
+	}
+	var onto *Commit
+	if upstream != "" {
+		var err error
+		if onto, err = repo.ResolveRevision(upstream); err != nil {
+			return nil, err
+		}
+	}
+	state := &rebaseState{Head: repo.head, Branch: repo.branch, Todo: []RebaseStep{}, Conflicts: []string{}}
+	var err error
+	if plan == nil {
+		if onto == nil {
+			return nil, errors.New("rebase needs an upstream or a plan")
+		}
+		var upToDate bool
+		if state.Todo, upToDate, err = repo.rebaseSteps(onto); err != nil {
+			return nil, err
+		}
+		if upToDate {
+			return &RebaseResult{Onto: onto, UpToDate: true}, nil
+		}
+	} else if onto, err = repo.resolvePlan(plan, onto, state); err != nil {
+		return nil, err
+	}
+	if err = repo.requireClean("rebasing"); err != nil {
+		return nil, err
+	}
+	state.Onto = onto.Hash
+	command := "rebase (start): checkout " + onto.Hash
+	repo.branch = ""
+	if err = repo.resetTo(onto, nil, command); err == nil && onto.Hash == state.Head {
+		// resetTo leaves HEAD alone when the commit does not change
+		err = repo.setHead("", onto.Hash, command)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repo.rebaseNext(state, &RebaseResult{Onto: onto})
+}
+
+// rebaseSteps returns the steps that pick the commits that the current one
+// leads to and onto does not, oldest first, and whether onto already leads to
+// all of them.
+func (repo *Repository) rebaseSteps(onto *Commit) ([]RebaseStep, bool, error) {
+	upstream, err := repo.history([]string{onto.Hash})
+	if err != nil {
+		return nil, false, err
+	}
+	excluded := map[string]bool{}
+	for _, commit := range upstream {
+		excluded[commit.Hash] = true
+	}
+	history, err := repo.history([]string{repo.head})
+	if err != nil {
+		return nil, false, err
+	}
+	steps := []RebaseStep{}
+	upToDate := false
+	for i := len(history) - 1; i >= 0; i-- {
+		switch commit := history[i]; {
+		case commit.Hash == onto.Hash:
+			upToDate = true
+		case !excluded[commit.Hash]:
+			steps = append(steps, RebaseStep{Action: RebasePick, Commit: commit.Hash})
+		}
+	}
+	return steps, upToDate, nil
+}
+
+// resolvePlan checks plan, with the commits resolved, into state.Todo and
+// returns the commit to replay it on: onto or else the parent of its first commit.
+func (repo *Repository) resolvePlan(plan []RebaseStep, onto *Commit, state *rebaseState) (*Commit, error) {
+	melded := false
+	for _, step := range plan {
+		switch step.Action {
+		case RebaseSquash, RebaseFixup:
+			if !melded {
+				return nil, fmt.Errorf("can't %s %s without a previous commit", step.Action, step.Commit)
+			}
+		case RebaseReword:
+			if step.Message == "" {
+				return nil, fmt.Errorf("reword of %s has no message", step.Commit)
+			}
+			melded = true
+		case RebasePick:
+			melded = true
+		case RebaseDrop:
+		default:
+			return nil, fmt.Errorf("unknown rebase action '%s'", step.Action)
+		}
+		commit, err := repo.ResolveRevision(step.Commit)
+		if err != nil {
+			return nil, err
+		}
+		step.Commit = commit.Hash
+		state.Todo = append(state.Todo, step)
+		if onto == nil {
+			if len(commit.Parents) == 0 {
+				return nil, fmt.Errorf("%s has no parent to rebase onto, give an upstream", commit.Hash)
+			}
+			if onto, err = repo.ReadCommit(commit.Parents[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if onto == nil {
+		return nil, errors.New("the plan is empty")
+	}
+	return onto, nil
+}
+
+// RebaseContinue commits the resolved changes of the step a rebase stopped at
+// and carries out the rest of the plan.
+func (repo *Repository) RebaseContinue() (*RebaseResult, error) {
+	state, err := repo.readRebase()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errNotRebasing
+	}
+	if err = repo.checkResolved(state.Conflicts); err != nil {
+		return nil, err
+	}
+	result, err := repo.rebaseResult(state)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repo.ReadCommit(state.Todo[0].Commit)
+	if err != nil {
+		return nil, err
+	}
+	if err = repo.commitStep(state.Todo[0], commit, result); err != nil {
+		return nil, err
+	}
+	state.Todo, state.Conflicts = state.Todo[1:], []string{}
+	return repo.rebaseNext(state, result)
+}
+
+// RebaseSkip leaves out the step a rebase stopped at, discarding its changes,
+// and carries out the rest of the plan.
+func (repo *Repository) RebaseSkip() (*RebaseResult, error) {
+	state, err := repo.readRebase()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errNotRebasing
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	if err = repo.resetTo(head, state.Conflicts, "rebase (skip)"); err != nil {
+		return nil, err
+	}
+	result, err := repo.rebaseResult(state)
+	if err != nil {
+		return nil, err
+	}
+	state.Todo, state.Conflicts = state.Todo[1:], []string{}
+	return repo.rebaseNext(state, result)
+}
+
+// RebaseAbort ends a rebase, returning to the commit and the branch that were
+// current when it started with its index and tracked files.
+func (repo *Repository) RebaseAbort() (*Commit, error) {
+	state, err := repo.readRebase()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errNotRebasing
+	}
+	commit, err := repo.ReadCommit(state.Head)
+	if err != nil {
+		return nil, err
+	}
+	command := "rebase (abort): returning to " + commit.Hash
+	if state.Branch != "" {
+		command = "rebase (abort): returning to " + branchPath(state.Branch)
+	}
+	if err = repo.resetTo(commit, state.Conflicts, command); err != nil {
+		return nil, err
+	}
+	if err = repo.reattach(state.Branch, command); err != nil {
+		return nil, err
+	}
+	return commit, ioError(repo.store.Remove(rebaseFilename))
+}
+
+// readRebase loads the rebase state, or returns nil if there is none.
+func (repo *Repository) readRebase() (*rebaseState, error) {
+	data, err := repo.store.ReadFile(rebaseFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ioError(err)
+	}
+	var state rebaseState
+	if err = decodeStrict(rebaseFilename, data, &state); err != nil {
+		return nil, err
+	}
+	for _, id := range []string{state.Head, state.Onto} {
+		if !ValidID(id) {
+			return nil, corruptError(rebaseFilename, "bad commit id '%s'", id)
+		}
+	}
+	if state.Branch != "" && !ValidRefName(state.Branch) {
+		return nil, corruptError(rebaseFilename, "bad branch '%s'", state.Branch)
+	}
+	for _, step := range state.Todo {
+		if !ValidID(step.Commit) {
+			return nil, corruptError(rebaseFilename, "bad commit id '%s'", step.Commit)
+		}
+		if rebaseActions[step.Action] != step.Action {
+			return nil, corruptError(rebaseFilename, "unknown action '%s'", step.Action)
+		}
+	}
+	if len(state.Todo) == 0 {
+		return nil, corruptError(rebaseFilename, "no step left")
+	}
+	return &state, nil
+}
+
+func (repo *Repository) rebaseResult(state *rebaseState) (*RebaseResult, error) {
+	onto, err := repo.ReadCommit(state.Onto)
+	if err != nil {
+		return nil, err
+	}
+	return &RebaseResult{Onto: onto}, nil
+}
+
+// rebaseNext carries out the steps of state.Todo in turn. If one conflicts,
+// it saves state to go on later; otherwise it moves the rebased branch to the
+// result and clears it.
+func (repo *Repository) rebaseNext(state *rebaseState, result *RebaseResult) (*RebaseResult, error) {
+	for ; len(state.Todo) > 0; state.Todo = state.Todo[1:] {
+		step := state.Todo[0]
+		if step.Action == RebaseDrop {
+			continue
+		}
+		commit, err := repo.ReadCommit(step.Commit)
+		if err != nil {
+			return nil, err
+		}
+		conflicts, err := repo.pick(commit)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			state.Conflicts = conflicts
+			result.Stopped, result.Conflicts = commit, conflicts
+			return result, repo.writeJSON(rebaseFilename, state)
+		}
+		if err = repo.commitStep(step, commit, result); err != nil {
+			return nil, err
+		}
+	}
+	if err := repo.reattach(state.Branch, "rebase (finish): onto "+state.Onto); err != nil {
+		return nil, err
+	}
+	if err := repo.store.Remove(rebaseFilename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, ioError(err)
+	}
+	return result, nil
+}
+
+// reattach moves branch, unless it is "", to the current commit, which HEAD
+// is detached at, and attaches HEAD to it, recording command in the reflogs.
+func (repo *Repository) reattach(branch, command string) error {
+	if branch == "" {
+		return nil
+	}
+	name := branchPath(branch)
+	old, err := repo.readRef(name)
+	if err != nil {
+		return err
+	}
+	if old != repo.head {
+		if err = repo.writeRef(name, repo.head); err != nil {
+			return err
+		}
+		if err = repo.logRef(name, old, repo.head, command); err != nil {
+			return err
+		}
+	}
+	return repo.setHead(branch, repo.head, command)
+}
+
+// commitStep commits the index, where the changes of the commit of step have
+// been applied, as step says and records the outcome in result.
+func (repo *Repository) commitStep(step RebaseStep, commit *Commit, result *RebaseResult) error {
+	if step.Action == RebaseSquash || step.Action == RebaseFixup {
+		head, err := repo.Head()
+		if err != nil {
+			return err
+		}
+		message := head.Message
+		if step.Action == RebaseSquash {
+			message = strings.TrimRight(message, "\n") + "\n\n" + commit.Message
+		}
+		melded, err := repo.amend(message, "rebase ("+step.Action+"): ")
+		if err != nil {
+			return err
+		}
+		// The melded commit replaces the previous one if this run made it
+		if n := len(result.Commits); n > 0 && result.Commits[n-1].Hash == head.Hash {
+			result.Commits[n-1] = melded
+		} else {
+			result.Commits = append(result.Commits, melded)
+		}
+		return nil
+	}
+	message := commit.Message
+	if step.Action == RebaseReword {
+		message = step.Message
+	}
+	copied, err := repo.commitCopy(commit, message, "rebase ("+step.Action+"): ")
+	if err != nil {
+		return err
+	}
+	if copied == nil {
+		result.Empty = append(result.Empty, commit)
+	} else {
+		result.Commits = append(result.Commits, copied)
+	}
+	return nil
+}
+
+// checkNoSequence fails if a cherry-pick or a rebase is in progress.
+func (repo *Repository) checkNoSequence() error {
+	for _, name := range []string{cherryPickFilename, rebaseFilename} {
+		_, err := repo.store.Stat(name)
+		if err == nil {
+			operation := strings.TrimSuffix(name, ".txt")
+			return fmt.Errorf("a %s is in progress, use 'svcs %s --continue' or '--abort'", operation, operation)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return ioError(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package svcs
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newRebaseRepository returns a repository where main changes the first line
+// of a.txt and the branch topic, which is checked out, starts from the same
+// commit, adds b.txt and changes the last line of a.txt to last.
+func newRebaseRepository(t *testing.T, last string) (*Repository, []*Commit) {
+	t.Helper()
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "1\n2\n3\n")
+	mustAdd(t, repo, "a.txt")
+	base := mustCommit(t, repo, "base")
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\n3\n")
+	mustAdd(t, repo, "a.txt")
+	mustCommit(t, repo, "first line")
+
+	if err := repo.writeRef(branchPath("topic"), base.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Checkout("topic"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo.WorkTree(), "b.txt", "b\n")
+	mustAdd(t, repo, "b.txt")
+	add := mustCommit(t, repo, "add b")
+	writeFile(t, repo.WorkTree(), "a.txt", "1\n2\n"+last)
+	mustAdd(t, repo, "a.txt")
+	change := mustCommit(t, repo, "last line")
+	return repo, []*Commit{add, change}
+}
+
+func TestParseRebasePlan(t *testing.T) {
+	steps, err := ParseRebasePlan("# plan\npick 1234 add b\n\nr 5678  New message \nf abcd\ns HEAD\nd HEAD~1 gone\n")
+	want := []RebaseStep{
+		{RebasePick, "1234", ""},
+		{RebaseReword, "5678", "New message"},
+		{RebaseFixup, "abcd", ""},
+		{RebaseSquash, "HEAD", ""},
+		{RebaseDrop, "HEAD~1", ""},
+	}
+	if err != nil || !reflect.DeepEqual(steps, want) {
+		t.Errorf("ParseRebasePlan() = %+v, %v, want %+v", steps, err, want)
+	}
+	// The commit may also appear in the action or the message
+	steps, err = ParseRebasePlan("reword ewo  Reword ewo \n\tr\tr r\n")
+	want = []RebaseStep{{RebaseReword, "ewo", "Reword ewo"}, {RebaseReword, "r", "r"}}
+	if err != nil || !reflect.DeepEqual(steps, want) {
+		t.Errorf("ParseRebasePlan() = %+v, %v, want %+v", steps, err, want)
+	}
+	for _, plan := range []string{"edit 1234", "pick", "reword 1234", "reword 1234 \t"} {
+		if _, err = ParseRebasePlan(plan); err == nil {
+			t.Errorf("ParseRebasePlan(%q) succeeded", plan)
+		}
+	}
+}
+
+func TestRebase(t *testing.T) {
+	repo, topic := newRebaseRepository(t, "three\n")
+	main, err := repo.ResolveRevision(DefaultBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := repo.Rebase(DefaultBranch, nil)
+	if err != nil || len(result.Commits) != 2 || result.Stopped != nil || result.Onto.Hash != main.Hash {
+		t.Fatalf("Rebase() = %+v, %v", result, err)
+	}
+	for i, commit := range result.Commits {
+		if commit.Message != topic[i].Message || !commit.Date.Equal(topic[i].Date) {
+			t.Errorf("commit %d = %+v, a copy of %+v", i, commit, topic[i])
+		}
+	}
+	if result.Commits[0].Parents[0] != main.Hash || result.Commits[1].Parents[0] != result.Commits[0].Hash {
+		t.Errorf("rebased commits are not on top of %s: %+v", main.Hash, result.Commits)
+	}
+	if repo.Branch() != "topic" || repo.head != result.Commits[1].Hash {
+		t.Errorf("HEAD is %s on %q", repo.head, repo.Branch())
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "one\n2\nthree\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+
+	if result, err = repo.Rebase(DefaultBranch, nil); err != nil || !result.UpToDate {
+		t.Errorf("Rebase() again = %+v, %v", result, err)
+	}
+}
+
+func TestRebasePlan(t *testing.T) {
+	repo := newTestRepository(t)
+	var commits []*Commit
+	for _, name := range []string{"base", "c1", "c2", "c3", "c4"} {
+		writeFile(t, repo.WorkTree(), name, name)
+		mustAdd(t, repo, name)
+		commits = append(commits, mustCommit(t, repo, name))
+	}
+	plan := []RebaseStep{
+		{RebasePick, commits[1].Hash, ""},
+		{RebaseReword, commits[3].Hash, "Third"},
+		{RebaseFixup, commits[2].Hash, ""},
+		{RebaseSquash, "HEAD", ""},
+		{RebaseDrop, "HEAD~1", ""},
+	}
+	result, err := repo.Rebase("", plan)
+	if err != nil || len(result.Commits) != 2 || result.Onto.Hash != commits[0].Hash {
+		t.Fatalf("Rebase() = %+v, %v", result, err)
+	}
+	if result.Commits[0].Hash != commits[1].Hash {
+		t.Errorf("picking %s in place made %s", commits[1].Hash, result.Commits[0].Hash)
+	}
+	last := result.Commits[1]
+	if last.Message != "Third\n\nc4" || repo.head != last.Hash {
+		t.Errorf("last commit = %+v, HEAD %s", last, repo.head)
+	}
+	snap, err := repo.readTree(last.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, entry := range snap.Files {
+		files = append(files, entry.Path)
+	}
+	if want := []string{"base", "c1", "c2", "c3", "c4"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+
+	if _, err = repo.Rebase("", []RebaseStep{{RebaseSquash, "HEAD", ""}}); err == nil {
+		t.Errorf("Rebase() of a plan starting with squash succeeded")
+	}
+	if _, err = repo.Rebase("", []RebaseStep{{RebasePick, commits[0].Hash, ""}}); err == nil {
+		t.Errorf("Rebase() of the root commit without upstream succeeded")
+	}
+}
+
+func TestRebaseConflict(t *testing.T) {
+	repo, topic := newRebaseRepository(t, "THREE\n")
+	writeFile(t, repo.WorkTree(), "c.txt", "c\n")
+	mustAdd(t, repo, "c.txt")
+	tip := mustCommit(t, repo, "add c")
+	if _, err := repo.Checkout(DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\nthree\n")
+	mustAdd(t, repo, "a.txt")
+	main := mustCommit(t, repo, "third line")
+	if _, err := repo.Checkout("topic"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := repo.Rebase(DefaultBranch, nil)
+	if err != nil || result.Stopped == nil || result.Stopped.Hash != topic[1].Hash || len(result.Commits) != 1 {
+		t.Fatalf("Rebase() = %+v, %v", result, err)
+	}
+	if _, err = repo.CherryPick([]string{tip.Hash}); err == nil {
+		t.Errorf("CherryPick() during a rebase succeeded")
+	}
+	// The branch stays at its tip until the rebase finishes
+	if ref, err := repo.readRef(branchPath("topic")); err != nil || ref != tip.Hash || repo.Branch() != "" {
+		t.Errorf("during the rebase, topic is at %s, %v, and HEAD on %q", ref, err, repo.Branch())
+	}
+	commit, err := repo.RebaseAbort()
+	if err != nil || commit.Hash != tip.Hash || repo.head != tip.Hash || repo.Branch() != "topic" {
+		t.Fatalf("RebaseAbort() = %v, %v, HEAD %s on %q", commit, err, repo.head, repo.Branch())
+	}
+
+	if _, err = repo.Rebase(DefaultBranch, nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err = repo.RebaseSkip()
+	if err != nil || result.Stopped != nil || len(result.Commits) != 1 {
+		t.Fatalf("RebaseSkip() = %+v, %v", result, err)
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "one\n2\nthree\n" {
+		t.Errorf("after skipping, a.txt = %q", got)
+	}
+	if _, err = repo.RebaseSkip(); err == nil {
+		t.Errorf("RebaseSkip() once done succeeded")
+	}
+
+	if _, err = repo.RebaseAbort(); err == nil {
+		t.Errorf("RebaseAbort() once done succeeded")
+	}
+	result, err = repo.Rebase(main.Hash, []RebaseStep{{RebasePick, topic[1].Hash, ""}})
+	if err != nil || result.Stopped == nil {
+		t.Fatalf("Rebase() of a plan = %+v, %v", result, err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\nthree, THREE\n")
+	mustAdd(t, repo, "a.txt")
+	result, err = repo.RebaseContinue()
+	if err != nil || len(result.Commits) != 1 || result.Commits[0].Parents[0] != main.Hash || repo.head != result.Commits[0].Hash {
+		t.Fatalf("RebaseContinue() = %+v, %v", result, err)
+	}
+	if ref, err := repo.readRef(branchPath("topic")); err != nil || ref != repo.head || repo.Branch() != "topic" {
+		t.Errorf("once rebased, topic is at %s, %v, and HEAD on %q", ref, err, repo.Branch())
+	}
+}
@@ -0,0 +1,155 @@
+package svcs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logsDir holds the reflog of HEAD, logs/HEAD, and of every branch, such as
+// logs/refs/heads/main: one JSON ReflogEntry per line, oldest first. Entries
+// are only ever appended.
+const logsDir = "logs"
+
+// ReflogEntry is a movement of HEAD or a branch from one commit to another.
+// Old is empty when the ref was created.
+type ReflogEntry struct {
+	Old     string    `json:"old"`
+	New     string    `json:"new"`
+	Actor   string    `json:"actor"`
+	Email   string    `json:"email,omitempty"`
+	Date    time.Time `json:"date"`
+	Command string    `json:"command"`
+}
+
+// reflogPath returns the reflog file of the ref file name, such as "HEAD" or "refs/heads/main".
+func reflogPath(name string) string {
+	return path.Join(logsDir, name)
+}
+
+// logRef appends the movement of the ref file name from old to id, caused by
+// command, to its reflog.
+func (repo *Repository) logRef(name, old, id, command string) error {
+	date, err := commitDate(time.Now())
+	if err != nil {
+		return err
+	}
+	entry := ReflogEntry{
+		Old:     old,
+		New:     id,
+		Actor:   repo.Config.GetString("user.name"),
+		Email:   repo.Config.GetString("user.email"),
+		Date:    date,
+		Command: command,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	name = reflogPath(name)
+	if err = repo.store.MkdirAll(path.Dir(name)); err != nil {
+		return ioError(err)
+	}
+	return ioError(repo.store.AppendFile(name, append(data, '\n')))
+}
+
+// Reflog returns the movements of ref, HEAD or a branch name, newest first.
+func (repo *Repository) Reflog(ref string) ([]ReflogEntry, error) {
+	name := headFilename
+	if ref != Head {
+		if !ValidRefName(ref) {
+			return nil, NewError(ErrUnknownRevision, "bad ref name '%s'", ref)
+		}
+		name = branchPath(ref)
+	}
+	entries, err := readReflog(repo.store, name)
+	if errors.Is(err, fs.ErrNotExist) && ref != Head {
+		id, err := repo.readRef(name)
+		if err != nil {
+			return nil, err
+		}
+		if id == "" {
+			return nil, NewError(ErrUnknownRevision, "branch '%s' does not exist", ref)
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return []ReflogEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// readReflog returns the entries of the reflog of the ref file name, oldest
+// first. It fails with fs.ErrNotExist if there is none.
+func readReflog(store FS, name string) ([]ReflogEntry, error) {
+	name = reflogPath(name)
+	data, err := store.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, ioError(err)
+	}
+	entries := []ReflogEntry{}
+	lines := strings.SplitAfter(string(data), "\n")
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		where := fmt.Sprintf("%s, line %d", name, i+1)
+		if !strings.HasSuffix(line, "\n") {
+			return nil, corruptError(where, "missing final newline")
+		}
+		var entry ReflogEntry
+		if err := decodeStrict(where, []byte(line), &entry); err != nil {
+			return nil, err
+		}
+		if (entry.Old != "" && !ValidID(entry.Old)) || !ValidID(entry.New) {
+			return nil, corruptError(where, "bad commit id")
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// reflogNames returns the names of the ref files that have a reflog, such as "HEAD".
+func (repo *Repository) reflogNames() ([]string, error) {
+	var names []string
+	err := fs.WalkDir(repo.store, logsDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == logsDir {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			names = append(names, strings.TrimPrefix(name, logsDir+"/"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ioError(err)
+	}
+	return names, nil
+}
+
+// cutReflog splits a revision base of the form "<ref>@{<n>}" into the ref and n.
+func cutReflog(base string) (string, int, bool) {
+	ref, rest, ok := strings.Cut(base, "@{")
+	digits, ok2 := strings.CutSuffix(rest, "}")
+	if !ok || !ok2 || digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	return ref, n, err == nil
+}
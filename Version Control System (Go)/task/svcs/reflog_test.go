@@ -0,0 +1,68 @@
+package svcs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReflog(t *testing.T) {
+	repo, first, second, _ := newFsckRepository(t)
+	if _, err := repo.Checkout(first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Reflog(Head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ old, new, command string }{
+		{second.Hash, first.Hash, "checkout: moving from main to " + first.Hash},
+		{first.Hash, second.Hash, "commit: second"},
+		{"", first.Hash, "commit (initial): first"},
+	}
+	if len(head) != len(want) {
+		t.Fatalf("Reflog(HEAD) = %+v, want %d entries", head, len(want))
+	}
+	for i, entry := range head {
+		if entry.Old != want[i].old || entry.New != want[i].new || entry.Command != want[i].command || entry.Actor != "Ann" {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+	// Detaching HEAD leaves the branch where it is
+	if main, err := repo.Reflog("main"); err != nil || len(main) != 2 || main[0].New != second.Hash {
+		t.Errorf("Reflog(main) = %+v, %v", main, err)
+	}
+	if commit, err := repo.ResolveRevision("HEAD@{1}"); err != nil || commit.Hash != second.Hash {
+		t.Errorf("HEAD@{1} = %v, %v", commit, err)
+	}
+	if _, err := repo.Reflog("other"); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("Reflog of a missing branch: got %v, want ErrUnknownRevision", err)
+	}
+}
+
+func TestReflogKeepsCommits(t *testing.T) {
+	repo, first, second, _ := newFsckRepository(t)
+	// Moving main back leaves the second commit to the reflog alone
+	writeFile(t, repo.Storage(), branchPath("main"), first.Hash+"\n")
+	check, err := FsckFS(repo.Storage())
+	if err != nil || len(check.Problems) != 0 {
+		t.Fatalf("FsckFS() = %+v, %v", check, err)
+	}
+	for _, object := range check.Dangling {
+		if object.ID == second.Hash {
+			t.Errorf("a commit of the reflog is dangling")
+		}
+	}
+	if _, err = repo.GC(GCOptions{Expire: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := repo.hasObject(second.Hash); !ok || err != nil {
+		t.Errorf("GC() removed a commit of the reflog: %v", err)
+	}
+
+	writeFile(t, repo.Storage(), "logs/HEAD", `{"old":"","new":"main"}`+"\n")
+	check, err = FsckFS(repo.Storage())
+	if err != nil || len(check.Problems) != 1 || !strings.Contains(check.Problems[0], "logs/HEAD, line 1: bad commit id") {
+		t.Errorf("FsckFS() with a bad reflog = %+v, %v", check, err)
+	}
+}
@@ -0,0 +1,195 @@
+package svcs
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+const (
+	headFilename = "HEAD"
+	refsDir      = "refs"
+	branchesDir  = refsDir + "/heads"
+	// DefaultBranch is the branch of a new repository unless init.defaultBranch says otherwise.
+	DefaultBranch = "main"
+	symrefPrefix  = "ref: "
+)
+
+// ValidRefName reports whether name can be used as a branch name.
+func ValidRefName(name string) bool {
+	if name == "" || name == Head || strings.HasPrefix(name, "-") || strings.HasSuffix(name, ".lock") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	for _, r := range name {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\@{", r) {
+			return false
+		}
+	}
+	return !strings.Contains(name, "..")
+}
+
+func branchPath(name string) string {
+	return path.Join(branchesDir, name)
+}
+
+// readHead loads HEAD, which names either a branch or, when detached, a commit.
+func (repo *Repository) readHead() error {
+	data, err := repo.store.ReadFile(headFilename)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return corruptError(headFilename, "missing")
+		}
+		return ioError(err)
+	}
+	value, ok := strings.CutSuffix(string(data), "\n")
+	if !ok {
+		return corruptError(headFilename, "missing final newline")
+	}
+	if ref, ok := strings.CutPrefix(value, symrefPrefix); ok {
+		branch, ok := strings.CutPrefix(ref, branchesDir+"/")
+		if !ok || !ValidRefName(branch) {
+			return corruptError(headFilename, "bad branch '%s'", ref)
+		}
+		repo.branch = branch
+		repo.head, err = repo.readRef(branchPath(branch))
+		return err
+	}
+	if !ValidID(value) {
+		return corruptError(headFilename, "bad commit id '%s'", value)
+	}
+	repo.branch, repo.head = "", value
+	return nil
+}
+
+// readRef returns the commit id stored in the ref file name, or "" if it does not exist.
+func (repo *Repository) readRef(name string) (string, error) {
+	if info, err := repo.store.Stat(name); errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return "", nil
+	}
+	data, err := repo.store.ReadFile(name)
+	if err != nil {
+		return "", ioError(err)
+	}
+	id, ok := strings.CutSuffix(string(data), "\n")
+	if !ok || !ValidID(id) {
+		return "", corruptError(name, "bad commit id '%s'", strings.TrimSpace(string(data)))
+	}
+	return id, nil
+}
+
+func (repo *Repository) writeRef(name, id string) error {
+	if err := repo.store.MkdirAll(path.Dir(name)); err != nil {
+		return ioError(err)
+	}
+	return ioError(repo.store.WriteFile(name, []byte(id+"\n")))
+}
+
+// setHead attaches HEAD to branch, or detaches it at the commit id if branch
+// is empty, and records the move, caused by command, in the reflog of HEAD.
+func (repo *Repository) setHead(branch, id, command string) error {
+	value := id
+	if branch != "" {
+		value = symrefPrefix + branchPath(branch)
+	}
+	if err := repo.store.WriteFile(headFilename, []byte(value+"\n")); err != nil {
+		return ioError(err)
+	}
+	old := repo.head
+	repo.branch, repo.head = branch, id
+	return repo.logRef(headFilename, old, id, command)
+}
+
+// moveHead makes id the current commit, advancing the current branch if
+// there is one, and records the move, caused by command, in the reflogs.
+func (repo *Repository) moveHead(id, command string) error {
+	if repo.branch == "" {
+		return repo.setHead("", id, command)
+	}
+	name := branchPath(repo.branch)
+	if err := repo.writeRef(name, id); err != nil {
+		return err
+	}
+	old := repo.head
+	repo.head = id
+	if err := repo.logRef(name, old, id, command); err != nil {
+		return err
+	}
+	return repo.logRef(headFilename, old, id, command)
+}
+
+// Branch returns the name of the current branch, or "" if HEAD is detached.
+func (repo *Repository) Branch() string {
+	return repo.branch
+}
+
+// Branches returns the names of all branches.
+func (repo *Repository) Branches() ([]string, error) {
+	var names []string
+	err := fs.WalkDir(repo.store, branchesDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == branchesDir {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			names = append(names, strings.TrimPrefix(name, branchesDir+"/"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ioError(err)
+	}
+	return names, nil
+}
+
+// refNames returns the names of all ref files, such as "refs/heads/main".
+func (repo *Repository) refNames() ([]string, error) {
+	var names []string
+	err := fs.WalkDir(repo.store, refsDir, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == refsDir {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ioError(err)
+	}
+	return names, nil
+}
+
+// Ref is a named pointer to a commit, such as a branch or a tag.
+type Ref struct {
+	// Name is the full name of the ref, such as "refs/heads/main" or "refs/tags/v1".
+	Name   string `json:"name"`
+	Commit string `json:"commit"`
+}
+
+// Refs returns every ref, sorted by name.
+func (repo *Repository) Refs() ([]Ref, error) {
+	names, err := repo.refNames()
+	if err != nil {
+		return nil, err
+	}
+	refs := []Ref{}
+	for _, name := range names {
+		id, err := repo.readRef(name)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, Ref{name, id})
+	}
+	return refs, nil
+}
@@ -0,0 +1,456 @@
+// Package svcs implements a simple version control system: a work tree with
+// a set of tracked files and a history of commits stored in its vcs directory.
+package svcs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Dir is the name of the repository directory inside the work tree.
+	Dir            = "vcs"
+	configFilename = "config.txt"
+	indexFilename  = "index.txt"
+)
+
+// Repository is a work tree together with the contents of its vcs directory.
+type Repository struct {
+	Config *Config
+
+	work  FS
+	store FS
+	// index holds the snapshot of the tracked files that the next commit records
+	index  snapshot
+	branch string
+	head   string
+	// packs caches the pack indexes once packsLoaded
+	packs       []*pack
+	packsLoaded bool
+}
+
+// Init creates the repository of the work tree at root, or opens it if it already exists.
+func Init(root string) (*Repository, error) {
+	return InitFS(NewOSFS(root), NewOSFS(filepath.Join(root, Dir)))
+}
+
+// Open opens the existing repository of the work tree at root.
+func Open(root string) (*Repository, error) {
+	return OpenFS(NewOSFS(root), NewOSFS(filepath.Join(root, Dir)))
+}
+
+// InitFS creates a repository for the work tree work whose vcs directory is
+// store, or opens it if it already exists.
+func InitFS(work, store FS) (*Repository, error) {
+	if info, err := store.Stat("."); err == nil && !info.IsDir() {
+		return nil, NewError(ErrNotARepo, "'%s' is not a directory", Dir)
+	}
+	version, err := readFormat(store)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		if err = createLayout(store); err != nil {
+			return nil, err
+		}
+		// FORMAT comes last: it marks the repository as complete
+		if err = writeFormat(store, FormatVersion); err != nil {
+			return nil, err
+		}
+	}
+	return OpenFS(work, store)
+}
+
+// createLayout writes the directories and HEAD of an empty repository to store.
+func createLayout(store FS) error {
+	config, err := LoadConfig(nil)
+	if err != nil {
+		return err
+	}
+	branch := config.GetString("init.defaultBranch")
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	if !ValidRefName(branch) {
+		return fmt.Errorf("init.defaultBranch: invalid branch name '%s'", branch)
+	}
+	for _, dir := range []string{objectsDir, branchesDir} {
+		if err = store.MkdirAll(dir); err != nil {
+			return ioError(err)
+		}
+	}
+	return ioError(store.WriteFile(headFilename, []byte(symrefPrefix+branchPath(branch)+"\n")))
+}
+
+// OpenFS opens the existing repository for the work tree work whose vcs directory is store.
+func OpenFS(work, store FS) (*Repository, error) {
+	info, err := store.Stat(".")
+	if err == nil && !info.IsDir() {
+		return nil, NewError(ErrNotARepo, "'%s' is not a directory", Dir)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, ioError(err)
+	}
+	if err = checkFormat(store); err != nil {
+		return nil, err
+	}
+	repo := &Repository{work: work, store: store}
+	if repo.Config, err = LoadConfig(store); err != nil {
+		return nil, err
+	}
+	if err = repo.readIndex(); err != nil {
+		return nil, err
+	}
+	if err = repo.readHead(); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// WorkTree returns the filesystem of the work tree.
+func (repo *Repository) WorkTree() FS {
+	return repo.work
+}
+
+// Storage returns the filesystem of the vcs directory.
+func (repo *Repository) Storage() FS {
+	return repo.store
+}
+
+// WorkTreeDir returns the directory of the work tree on the local
+// filesystem, or "" if it is not an OSFS.
+func (repo *Repository) WorkTreeDir() string {
+	return osRoot(repo.work)
+}
+
+// StorageDir returns the vcs directory on the local filesystem, or "" if it
+// is not an OSFS.
+func (repo *Repository) StorageDir() string {
+	return osRoot(repo.store)
+}
+
+func (repo *Repository) readIndex() error {
+	repo.index = snapshot{}
+	data, err := repo.store.ReadFile(indexFilename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return ioError(err)
+	}
+	if err = decodeStrict(indexFilename, data, &repo.index); err != nil {
+		return err
+	}
+	return repo.index.validate(indexFilename)
+}
+
+func (repo *Repository) writeIndex() error {
+	return repo.writeJSON(indexFilename, repo.index)
+}
+
+func (repo *Repository) writeJSON(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioError(repo.store.WriteFile(name, data))
+}
+
+// CleanPath converts a path relative to the work tree root to the slash-separated form used in the index.
+func CleanPath(path string) (string, error) {
+	clean := filepath.ToSlash(filepath.Clean(path))
+	if filepath.IsAbs(path) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("'%s' is outside the work tree", path)
+	}
+	if clean == Dir || strings.HasPrefix(clean, Dir+"/") {
+		return "", fmt.Errorf("'%s' is inside the repository directory", path)
+	}
+	return clean, nil
+}
+
+// Add stages the current contents of the given files for the next commit.
+// A tracked file that was deleted from the work tree is staged as removed.
+func (repo *Repository) Add(paths ...string) error {
+	for _, path := range paths {
+		name, err := CleanPath(path)
+		if err != nil {
+			return err
+		}
+		info, err := repo.work.Stat(name)
+		if errors.Is(err, fs.ErrNotExist) && repo.IsTracked(name) {
+			repo.index.set(name, "")
+			continue
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("can't find '%s'", path)
+		}
+		if err != nil {
+			return ioError(err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("'%s' is a directory", path)
+		}
+		blob, err := repo.writeBlob(name, info.Size())
+		if err != nil {
+			return err
+		}
+		repo.index.set(name, blob)
+	}
+	return repo.writeIndex()
+}
+
+// StageTracked stages the changes of the work tree to tracked files, deleted
+// files included, and returns those files as Status listed them before.
+// Untracked files are left alone. restore puts the index back as it was, for
+// when the commit the changes were staged for does not happen.
+func (repo *Repository) StageTracked() (changed []FileStatus, restore func() error, err error) {
+	restore = func() error { return nil }
+	statuses, err := repo.Status()
+	if err != nil {
+		return nil, restore, err
+	}
+	var paths []string
+	for _, status := range statuses {
+		if status.Unstaged == StateModified || status.Unstaged == StateDeleted {
+			changed = append(changed, status)
+			paths = append(paths, status.Path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, restore, nil
+	}
+	previous := snapshot{Files: slices.Clone(repo.index.Files)}
+	restore = func() error {
+		repo.index = previous
+		return repo.writeIndex()
+	}
+	if err = repo.Add(paths...); err != nil {
+		return nil, restore, errors.Join(err, restore())
+	}
+	return changed, restore, nil
+}
+
+// writeBlob stores the work tree file name of the given size as a blob, or
+// in the large-object area, and returns the id of the object to track.
+func (repo *Repository) writeBlob(name string, size int64) (string, error) {
+	large, err := repo.isLarge(name, size)
+	if err != nil {
+		return "", err
+	}
+	if large {
+		return repo.writeLarge(name)
+	}
+	data, err := repo.work.ReadFile(name)
+	if err != nil {
+		return "", ioError(err)
+	}
+	return repo.writeObject(ObjectBlob, data)
+}
+
+// Tracked returns the tracked files sorted by path.
+func (repo *Repository) Tracked() []string {
+	files := make([]string, 0, len(repo.index.Files))
+	for _, entry := range repo.index.Files {
+		files = append(files, entry.Path)
+	}
+	return files
+}
+
+func (repo *Repository) IsTracked(name string) bool {
+	return repo.index.lookup(name) != ""
+}
+
+// Head returns the current commit, or nil if there are none yet.
+func (repo *Repository) Head() (*Commit, error) {
+	if repo.head == "" {
+		return nil, nil
+	}
+	return repo.ReadCommit(repo.head)
+}
+
+// commitDate returns the time to record in a commit: date, unless
+// SVCS_AUTHOR_DATE gives one in RFC 3339 format.
+func commitDate(date time.Time) (time.Time, error) {
+	if value := os.Getenv("SVCS_AUTHOR_DATE"); value != "" {
+		date, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("SVCS_AUTHOR_DATE: %w", err)
+		}
+		return date, nil
+	}
+	return date.Truncate(time.Second), nil
+}
+
+// Commit records the staged snapshot as a new commit by the configured user
+// on top of the current one.
+func (repo *Repository) Commit(message string) (*Commit, error) {
+	tree, err := repo.writeTree(repo.index)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	if head != nil && head.Tree == tree {
+		return nil, NewError(ErrNothingToCommit, "nothing to commit")
+	}
+	date, err := commitDate(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	commit := &Commit{
+		Tree:    tree,
+		Parents: []string{},
+		Author:  repo.Config.GetString("user.name"),
+		Email:   repo.Config.GetString("user.email"),
+		Date:    date,
+		Message: message,
+	}
+	if head != nil {
+		commit.Parents = []string{head.Hash}
+	}
+	if err = repo.writeCommit(commit); err != nil {
+		return nil, err
+	}
+	command := "commit: "
+	if head == nil {
+		command = "commit (initial): "
+	}
+	if err = repo.moveHead(commit.Hash, command+commit.Subject()); err != nil {
+		return nil, err
+	}
+	return commit, nil
+}
+
+// Amend replaces the current commit with one of the staged snapshot, which
+// includes its changes and anything staged since, with the same parents,
+// author and date. The message stays the same unless a new one is given.
+func (repo *Repository) Amend(message string) (*Commit, error) {
+	if message == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return nil, err
+		}
+		if head == nil {
+			return nil, NewError(ErrUnknownRevision, "there are no commits yet")
+		}
+		message = head.Message
+	}
+	return repo.amend(message, "commit (amend): ")
+}
+
+// amend replaces the current commit with one of the staged snapshot that has
+// the same parents, author and date but message, noting command and the
+// subject in the reflog.
+func (repo *Repository) amend(message, command string) (*Commit, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	if head == nil {
+		return nil, NewError(ErrUnknownRevision, "there are no commits yet")
+	}
+	tree, err := repo.writeTree(repo.index)
+	if err != nil {
+		return nil, err
+	}
+	commit := &Commit{
+		Tree:    tree,
+		Parents: head.Parents,
+		Author:  head.Author,
+		Email:   head.Email,
+		Date:    head.Date,
+		Message: message,
+	}
+	if err = repo.writeCommit(commit); err != nil {
+		return nil, err
+	}
+	return commit, repo.moveHead(commit.Hash, command+commit.Subject())
+}
+
+// OpenFileAt opens the contents of the file name as of the revision rev,
+// reading them straight from storage.
+func (repo *Repository) OpenFileAt(rev, name string) (io.ReadCloser, error) {
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := repo.readTree(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	clean, err := CleanPath(name)
+	if err != nil {
+		return nil, err
+	}
+	id := snap.lookup(clean)
+	if id == "" {
+		return nil, NewError(ErrUnknownRevision, "'%s' does not exist in '%s'", name, rev)
+	}
+	kind, data, err := repo.readFile(id)
+	if err != nil {
+		return nil, err
+	}
+	if kind == ObjectBlob {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	pointer, err := decodePointer(id, data)
+	if err != nil {
+		return nil, err
+	}
+	return repo.openLarge(pointer)
+}
+
+// Checkout overwrites the work tree files recorded in the revision rev with
+// their contents as of that commit and makes it the current one, tracking
+// exactly its files. Other files are left untouched. Checking out a branch
+// by name attaches HEAD to it; any other revision detaches HEAD.
+func (repo *Repository) Checkout(rev string) (*Commit, error) {
+	commit, err := repo.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := repo.readTree(commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range snap.Files {
+		if dir := path.Dir(entry.Path); dir != "." {
+			if err = repo.work.MkdirAll(dir); err != nil {
+				return nil, ioError(err)
+			}
+		}
+		if err = repo.writeWorkFile(entry.Path, entry.Object); err != nil {
+			return nil, err
+		}
+	}
+	repo.index = snap
+	if err = repo.writeIndex(); err != nil {
+		return nil, err
+	}
+	branch := ""
+	switch {
+	case rev == Head:
+		branch = repo.branch
+	case ValidRefName(rev):
+		if id, err := repo.readRef(branchPath(rev)); err == nil && id != "" {
+			branch = rev
+		}
+	}
+	from := repo.branch
+	if from == "" {
+		from = repo.head
+	}
+	return commit, repo.setHead(branch, commit.Hash, fmt.Sprintf("checkout: moving from %s to %s", from, rev))
+}
@@ -0,0 +1,623 @@
+package svcs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestRepository returns a repository held in memory, with a user configured.
+func newTestRepository(t *testing.T) *Repository {
+	t.Helper()
+	t.Setenv("SVCS_CONFIG_GLOBAL", "/nonexistent/svcsconfig")
+	t.Setenv("SVCS_CONFIG_SYSTEM", "/nonexistent/svcsconfig")
+	t.Setenv("SVCS_AUTHOR_DATE", "2024-05-01T12:00:00Z")
+	repo, err := InitFS(NewMemFS(), NewMemFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repo.Config.Set(ScopeRepository, "user.name", "Ann"); err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func writeFile(t *testing.T, fsys FS, name, content string) {
+	t.Helper()
+	if err := fsys.MkdirAll(path.Dir(name)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(name, []byte(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, fsys FS, name string) string {
+	t.Helper()
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func mustAdd(t *testing.T, repo *Repository, paths ...string) {
+	t.Helper()
+	if err := repo.Add(paths...); err != nil {
+		t.Fatalf("Add(%q): %v", paths, err)
+	}
+}
+
+func mustCommit(t *testing.T, repo *Repository, message string) *Commit {
+	t.Helper()
+	commit, err := repo.Commit(message)
+	if err != nil {
+		t.Fatalf("Commit(%q): %v", message, err)
+	}
+	return commit
+}
+
+func TestOpenFS(t *testing.T) {
+	store := NewMemFS()
+	if _, err := OpenFS(NewMemFS(), store); !errors.Is(err, ErrNotARepo) {
+		t.Errorf("OpenFS of an empty store: got %v, want ErrNotARepo", err)
+	}
+	if _, err := InitFS(NewMemFS(), store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFS(NewMemFS(), store); err != nil {
+		t.Errorf("OpenFS after InitFS: %v", err)
+	}
+}
+
+func TestInitOnFile(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, Dir), []byte("not a directory"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Init(root); !errors.Is(err, ErrNotARepo) {
+		t.Errorf("Init with a file named %s: got %v, want ErrNotARepo", Dir, err)
+	}
+	if _, err := Open(root); !errors.Is(err, ErrNotARepo) {
+		t.Errorf("Open with a file named %s: got %v, want ErrNotARepo", Dir, err)
+	}
+}
+
+func TestLocalDirs(t *testing.T) {
+	setGlobalConfig(t, "", "")
+	root := t.TempDir()
+	repo, err := Init(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.WorkTreeDir() != root || repo.StorageDir() != filepath.Join(root, Dir) {
+		t.Errorf("WorkTreeDir(), StorageDir() = %q, %q", repo.WorkTreeDir(), repo.StorageDir())
+	}
+	repo = newTestRepository(t)
+	if repo.WorkTreeDir() != "" || repo.StorageDir() != "" {
+		t.Errorf("in memory, WorkTreeDir(), StorageDir() = %q, %q", repo.WorkTreeDir(), repo.StorageDir())
+	}
+}
+
+func TestInitLayout(t *testing.T) {
+	setGlobalConfig(t, "", `{"init.defaultBranch":"trunk"}`)
+	store := NewMemFS()
+	repo, err := InitFS(NewMemFS(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, store, "FORMAT"); got != "2\n" {
+		t.Errorf("FORMAT = %q", got)
+	}
+	if got := readFile(t, store, "HEAD"); got != "ref: refs/heads/trunk\n" {
+		t.Errorf("HEAD = %q", got)
+	}
+	if repo.Branch() != "trunk" {
+		t.Errorf("Branch() = %q, want trunk", repo.Branch())
+	}
+	if head, err := repo.Head(); head != nil || err != nil {
+		t.Errorf("Head() of a new repository = %v, %v", head, err)
+	}
+}
+
+func TestOpenValidates(t *testing.T) {
+	const id = "87428fc522803d31065e7bce3cf03fe4"
+	tests := []struct {
+		name string
+		file string
+		data string
+		want error
+	}{
+		{"newer format", "FORMAT", "5\n", ErrFormat},
+		{"bad format", "FORMAT", "two\n", ErrCorrupt},
+		{"format without newline", "FORMAT", "4", ErrCorrupt},
+		{"detached HEAD", "HEAD", id + "\n", nil},
+		{"bad HEAD", "HEAD", "main\n", ErrCorrupt},
+		{"HEAD outside refs/heads", "HEAD", "ref: refs/tags/v1\n", ErrCorrupt},
+		{"bad branch", "refs/heads/main", "xyz\n", ErrCorrupt},
+		{"empty index", "index.txt", "", ErrCorrupt},
+		{"index", "index.txt", `{"files":[{"path":"a","object":"` + id + `"}]}`, nil},
+		{"index with an unknown field", "index.txt", `{"files":[],"version":1}`, ErrCorrupt},
+		{"index with trailing data", "index.txt", `{"files":[]} {}`, ErrCorrupt},
+		{"name-only index", "index.txt", `{"files":["a.txt"]}`, ErrCorrupt},
+		{"unsorted index", "index.txt", `{"files":[{"path":"b","object":"` + id + `"},{"path":"a","object":"` + id + `"}]}`, ErrCorrupt},
+		{"unclean path in index", "index.txt", `{"files":[{"path":"a/../b","object":"` + id + `"}]}`, ErrCorrupt},
+		{"bad object id in index", "index.txt", `{"files":[{"path":"a","object":"1234"}]}`, ErrCorrupt},
+		{"bad config key", "config.txt", `{"user":"Ann"}`, ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			writeFile(t, repo.Storage(), tt.file, tt.data)
+			_, err := OpenFS(repo.WorkTree(), repo.Storage())
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("OpenFS() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+		tracked string
+	}{
+		{"file", "a.txt", false, "a.txt"},
+		{"subdirectory", "dir/b.txt", false, "dir/b.txt"},
+		{"unclean path", "./dir//b.txt", false, "dir/b.txt"},
+		{"missing file", "missing.txt", true, ""},
+		{"directory", "dir", true, ""},
+		{"outside the work tree", "../a.txt", true, ""},
+		{"absolute", "/a.txt", true, ""},
+		{"repository directory", "vcs/log.txt", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newTestRepository(t)
+			writeFile(t, repo.WorkTree(), "a.txt", "a")
+			writeFile(t, repo.WorkTree(), "dir/b.txt", "b")
+			err := repo.Add(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Add(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(repo.Tracked()) != 0 {
+					t.Errorf("Tracked() = %v after failed Add", repo.Tracked())
+				}
+				return
+			}
+			if got := repo.Tracked(); !reflect.DeepEqual(got, []string{tt.tracked}) {
+				t.Errorf("Tracked() = %v, want [%s]", got, tt.tracked)
+			}
+		})
+	}
+}
+
+func TestAddTwice(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "a")
+	for i := 0; i < 2; i++ {
+		if err := repo.Add("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := repo.Tracked(); len(got) != 1 {
+		t.Errorf("Tracked() = %v, want a single entry", got)
+	}
+}
+
+func TestAddStagesDeletion(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "a")
+	mustAdd(t, repo, "a.txt")
+	if err := repo.WorkTree().Remove("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, repo, "a.txt")
+	if repo.IsTracked("a.txt") {
+		t.Error("a deleted file is still tracked after Add")
+	}
+	if err := repo.Add("a.txt"); err == nil {
+		t.Error("Add of a file that is neither present nor tracked succeeded")
+	}
+}
+
+func TestStageTracked(t *testing.T) {
+	repo := newTestRepository(t)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeFile(t, repo.WorkTree(), name, name)
+		mustAdd(t, repo, name)
+	}
+	mustCommit(t, repo, "first")
+	writeFile(t, repo.WorkTree(), "a.txt", "changed")
+	if err := repo.WorkTree().Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo.WorkTree(), "new.txt", "untracked")
+
+	changed, restore, err := repo.StageTracked()
+	want := []FileStatus{
+		{"a.txt", StateUnmodified, StateModified},
+		{"b.txt", StateUnmodified, StateDeleted},
+	}
+	if err != nil || !reflect.DeepEqual(changed, want) {
+		t.Errorf("StageTracked() = %+v, %v, want %+v", changed, err, want)
+	}
+	if repo.IsTracked("b.txt") || repo.IsTracked("new.txt") {
+		t.Errorf("tracked files = %v", repo.Tracked())
+	}
+	if again, _, err := repo.StageTracked(); err != nil || again != nil {
+		t.Errorf("StageTracked() again = %+v, %v", again, err)
+	}
+
+	if err = restore(); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.IsTracked("b.txt") {
+		t.Errorf("b.txt is not tracked once restored")
+	}
+	statuses, err := repo.Status()
+	if err != nil || statuses[0].Staged != StateUnmodified || statuses[0].Unstaged != StateModified {
+		t.Errorf("Status() once restored = %+v, %v", statuses, err)
+	}
+}
+
+func TestCommitAndLog(t *testing.T) {
+	repo := newTestRepository(t)
+	empty := mustCommit(t, repo, "empty")
+	writeFile(t, repo.WorkTree(), "a.txt", "one")
+	mustAdd(t, repo, "a.txt")
+	first := mustCommit(t, repo, "first")
+	if _, err := repo.Commit("again"); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("commit without changes: got %v, want ErrNothingToCommit", err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "two")
+	if _, err := repo.Commit("unstaged"); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("commit of unstaged changes: got %v, want ErrNothingToCommit", err)
+	}
+	mustAdd(t, repo, "a.txt")
+	second := mustCommit(t, repo, "second")
+
+	if first.Author != "Ann" || first.Message != "first" || first.Date.Format(time.RFC3339) != "2024-05-01T12:00:00Z" {
+		t.Errorf("first commit = %+v", first)
+	}
+	if !reflect.DeepEqual(first.Parents, []string{empty.Hash}) || len(empty.Parents) != 0 {
+		t.Errorf("parents: empty %v, first %v", empty.Parents, first.Parents)
+	}
+	snap, err := repo.readTree(first.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := repo.readObject(snap.lookup("a.txt"), ObjectBlob); err != nil || string(data) != "one" {
+		t.Errorf("stored a.txt = %q, %v, want %q", data, err, "one")
+	}
+	log, err := repo.Log(LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 3 || log[0].Hash != second.Hash || log[1].Hash != first.Hash || log[2].Hash != empty.Hash {
+		t.Errorf("Log() = %+v, want second, first, empty", log)
+	}
+	if branch, err := repo.readRef(branchPath(DefaultBranch)); err != nil || branch != second.Hash {
+		t.Errorf("branch %s = %s, %v, want %s", DefaultBranch, branch, err, second.Hash)
+	}
+
+	reopened, err := OpenFS(repo.WorkTree(), repo.Storage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.Log(LogOptions{}); err != nil || !reflect.DeepEqual(got, log) {
+		t.Errorf("Log() after reopening = %+v, %v, want %+v", got, err, log)
+	}
+}
+
+func TestCommitIDs(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "a")
+	mustAdd(t, repo, "a.txt")
+	commit := mustCommit(t, repo, "first")
+	// Commit ids depend on the whole commit, not only on the files
+	other := newTestRepository(t)
+	writeFile(t, other.WorkTree(), "a.txt", "a")
+	mustAdd(t, other, "a.txt")
+	if same := mustCommit(t, other, "first"); same.Hash != commit.Hash {
+		t.Errorf("identical commits got ids %s and %s", commit.Hash, same.Hash)
+	}
+	other = newTestRepository(t)
+	t.Setenv("SVCS_AUTHOR_DATE", "2024-05-02T12:00:00Z")
+	writeFile(t, other.WorkTree(), "a.txt", "a")
+	mustAdd(t, other, "a.txt")
+	if later := mustCommit(t, other, "first"); later.Hash == commit.Hash || later.Tree != commit.Tree {
+		t.Errorf("commit on another day: %+v, first: %+v", later, commit)
+	}
+	t.Setenv("SVCS_AUTHOR_DATE", "yesterday")
+	writeFile(t, other.WorkTree(), "a.txt", "b")
+	mustAdd(t, other, "a.txt")
+	if _, err := other.Commit("bad date"); err == nil {
+		t.Error("Commit with a bad SVCS_AUTHOR_DATE succeeded")
+	}
+}
+
+func TestCommitMissingTrackedFile(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "a")
+	writeFile(t, repo.WorkTree(), "b.txt", "b")
+	mustAdd(t, repo, "a.txt", "b.txt")
+	first := mustCommit(t, repo, "both")
+	if err := repo.WorkTree().Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Commit("unstaged deletion"); !errors.Is(err, ErrNothingToCommit) {
+		t.Errorf("commit of an unstaged deletion: got %v, want ErrNothingToCommit", err)
+	}
+	mustAdd(t, repo, "b.txt")
+	second := mustCommit(t, repo, "b deleted")
+	snap, err := repo.readTree(second.Tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.lookup("b.txt") != "" || snap.lookup("a.txt") == "" {
+		t.Errorf("tree after deleting b.txt = %+v", snap.Files)
+	}
+	if _, err := repo.Checkout(first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, repo.WorkTree(), "b.txt"); got != "b" {
+		t.Errorf("b.txt after checkout = %q, want %q", got, "b")
+	}
+}
+
+func TestSubdirectories(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "dir/sub/a.txt", "one")
+	mustAdd(t, repo, "dir/sub/a.txt")
+	first := mustCommit(t, repo, "first")
+	writeFile(t, repo.WorkTree(), "dir/sub/a.txt", "two")
+	mustAdd(t, repo, "dir/sub/a.txt")
+	mustCommit(t, repo, "second")
+
+	for _, name := range []string{"dir/sub/a.txt", "dir/sub", "dir"} {
+		if err := repo.WorkTree().Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.Checkout(first.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, repo.WorkTree(), "dir/sub/a.txt"); got != "one" {
+		t.Errorf("dir/sub/a.txt = %q, want %q", got, "one")
+	}
+}
+
+func TestCheckoutWithDifferentIndex(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "a1")
+	mustAdd(t, repo, "a.txt")
+	first := mustCommit(t, repo, "a only")
+	writeFile(t, repo.WorkTree(), "a.txt", "a2")
+	writeFile(t, repo.WorkTree(), "b.txt", "b2")
+	mustAdd(t, repo, "a.txt", "b.txt")
+	second := mustCommit(t, repo, "a and b")
+
+	if _, err := repo.Checkout(first.Hash); err != nil {
+		t.Fatalf("checkout of a commit without b.txt: %v", err)
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "a1" {
+		t.Errorf("a.txt = %q, want %q", got, "a1")
+	}
+	if got := readFile(t, repo.WorkTree(), "b.txt"); got != "b2" {
+		t.Errorf("b.txt = %q, want it left untouched", got)
+	}
+	if got := repo.Tracked(); !reflect.DeepEqual(got, []string{"a.txt"}) {
+		t.Errorf("Tracked() after checkout = %v, want [a.txt]", got)
+	}
+	if repo.Branch() != "" {
+		t.Errorf("checkout of a commit id left HEAD on branch %s", repo.Branch())
+	}
+	if _, err := repo.Checkout(second.Hash[:8]); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, repo.WorkTree(), "a.txt"); got != "a2" {
+		t.Errorf("a.txt = %q, want %q", got, "a2")
+	}
+}
+
+func TestCommitOnDetachedHead(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "1")
+	mustAdd(t, repo, "a.txt")
+	first := mustCommit(t, repo, "first")
+	writeFile(t, repo.WorkTree(), "a.txt", "2")
+	mustAdd(t, repo, "a.txt")
+	second := mustCommit(t, repo, "second")
+
+	if _, err := repo.Checkout("HEAD~1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "3")
+	mustAdd(t, repo, "a.txt")
+	detached := mustCommit(t, repo, "detached")
+	if !reflect.DeepEqual(detached.Parents, []string{first.Hash}) {
+		t.Errorf("parents of a commit on a detached HEAD = %v, want [%s]", detached.Parents, first.Hash)
+	}
+	if tip, err := repo.readRef(branchPath(DefaultBranch)); err != nil || tip != second.Hash {
+		t.Errorf("commit on a detached HEAD moved %s to %s, %v", DefaultBranch, tip, err)
+	}
+	if _, err := repo.Checkout(DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	if head, err := repo.Head(); err != nil || head.Hash != second.Hash || repo.Branch() != DefaultBranch {
+		t.Errorf("after checking out %s: Head() = %v, %v on branch %q", DefaultBranch, head, err, repo.Branch())
+	}
+	if got := readFile(t, repo.Storage(), "HEAD"); got != "ref: refs/heads/main\n" {
+		t.Errorf("HEAD = %q", got)
+	}
+}
+
+func TestAmend(t *testing.T) {
+	repo := newTestRepository(t)
+	if _, err := repo.Amend("nothing"); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("Amend() without commits = %v", err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "a")
+	mustAdd(t, repo, "a.txt")
+	first := mustCommit(t, repo, "first")
+	writeFile(t, repo.WorkTree(), "b.txt", "b")
+	mustAdd(t, repo, "b.txt")
+	second := mustCommit(t, repo, "secnod")
+
+	writeFile(t, repo.WorkTree(), "c.txt", "c")
+	mustAdd(t, repo, "c.txt")
+	amended, err := repo.Amend("")
+	if err != nil || amended.Message != "secnod" || !reflect.DeepEqual(amended.Parents, []string{first.Hash}) {
+		t.Fatalf("Amend(\"\") = %+v, %v", amended, err)
+	}
+	snap, err := repo.readTree(amended.Tree)
+	if err != nil || snap.lookup("b.txt") == "" || snap.lookup("c.txt") == "" {
+		t.Errorf("amended tree = %+v, %v, want b.txt and c.txt", snap, err)
+	}
+	tree := amended.Tree
+	if amended, err = repo.Amend("second"); err != nil || amended.Message != "second" || amended.Tree != tree {
+		t.Fatalf("Amend(\"second\") = %+v, %v", amended, err)
+	}
+	if tip, err := repo.readRef(branchPath(DefaultBranch)); err != nil || tip != amended.Hash {
+		t.Errorf("%s = %s, %v, want %s", DefaultBranch, tip, err, amended.Hash)
+	}
+	entries, err := repo.Reflog(DefaultBranch)
+	if err != nil || len(entries) != 4 || entries[0].Command != "commit (amend): second" || entries[1].Old != second.Hash {
+		t.Errorf("Reflog() = %+v, %v", entries, err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	repo := newTestRepository(t)
+	for _, name := range []string{"same.txt", "changed.txt", "staged.txt", "deleted.txt", "removed.txt"} {
+		writeFile(t, repo.WorkTree(), name, name)
+	}
+	mustAdd(t, repo, "same.txt", "changed.txt", "staged.txt", "deleted.txt", "removed.txt")
+	mustCommit(t, repo, "first")
+	writeFile(t, repo.WorkTree(), "changed.txt", "new contents")
+	writeFile(t, repo.WorkTree(), "staged.txt", "staged contents")
+	writeFile(t, repo.WorkTree(), "new.txt", "new")
+	writeFile(t, repo.WorkTree(), "dir/untracked.txt", "untracked")
+	writeFile(t, repo.WorkTree(), ".hidden/ignored.txt", "ignored")
+	for _, name := range []string{"deleted.txt", "removed.txt"} {
+		if err := repo.WorkTree().Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustAdd(t, repo, "new.txt", "staged.txt", "removed.txt")
+	writeFile(t, repo.WorkTree(), "new.txt", "changed after add")
+
+	statuses, err := repo.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileStatus{
+		{"changed.txt", StateUnmodified, StateModified},
+		{"deleted.txt", StateUnmodified, StateDeleted},
+		{"dir/untracked.txt", StateUntracked, StateUntracked},
+		{"new.txt", StateAdded, StateModified},
+		{"removed.txt", StateDeleted, StateUnmodified},
+		{"same.txt", StateUnmodified, StateUnmodified},
+		{"staged.txt", StateModified, StateUnmodified},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Status() = %v, want %v", statuses, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	repo := newTestRepository(t)
+	writeFile(t, repo.WorkTree(), "a.txt", "one\ntwo\n")
+	writeFile(t, repo.WorkTree(), "b.txt", "b\n")
+	mustAdd(t, repo, "a.txt", "b.txt")
+	diffs, err := repo.Diff("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].State != StateAdded || diffs[0].Patch != "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n" {
+		t.Errorf("Diff before the first commit = %+v", diffs)
+	}
+
+	mustCommit(t, repo, "first")
+	if diffs, err = repo.Diff(""); err != nil || len(diffs) != 0 {
+		t.Errorf("Diff of a clean work tree = %+v, %v", diffs, err)
+	}
+	writeFile(t, repo.WorkTree(), "a.txt", "one\n2\n")
+	if err = repo.WorkTree().Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = repo.Diff(Head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileDiff{
+		{"a.txt", StateModified, "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+2\n"},
+		{"b.txt", StateDeleted, "--- a/b.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-b\n"},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Errorf("Diff(HEAD) = %+v, want %+v", diffs, want)
+	}
+	// A staged removal is a deletion even if the file is still around
+	writeFile(t, repo.WorkTree(), "b.txt", "b\n")
+	if err = repo.WorkTree().Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	mustAdd(t, repo, "b.txt")
+	writeFile(t, repo.WorkTree(), "b.txt", "b\n")
+	if diffs, err = repo.Diff(""); err != nil || len(diffs) != 2 || diffs[1].State != StateDeleted {
+		t.Errorf("Diff with b.txt untracked = %+v, %v", diffs, err)
+	}
+	if _, err = repo.Diff("HEAD~3"); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("Diff(HEAD~3) = %v, want ErrUnknownRevision", err)
+	}
+}
+
+func FuzzOpenFS(f *testing.F) {
+	const id = "87428fc522803d31065e7bce3cf03fe4"
+	f.Add([]byte("ref: refs/heads/main\n"), []byte(`{"files":[{"path":"a.txt","object":"`+id+`"}]}`))
+	f.Add([]byte(id+"\n"), []byte(`{"files":[]}`))
+	f.Add([]byte(""), []byte(`{"files":["a.txt"]}`))
+	f.Fuzz(func(t *testing.T, headData, indexData []byte) {
+		t.Setenv("SVCS_CONFIG_GLOBAL", "/nonexistent/svcsconfig")
+		t.Setenv("SVCS_CONFIG_SYSTEM", "/nonexistent/svcsconfig")
+		repo, err := InitFS(NewMemFS(), NewMemFS())
+		if err != nil {
+			t.Fatal(err)
+		}
+		store := repo.Storage()
+		if err := store.WriteFile(headFilename, headData); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.WriteFile(indexFilename, indexData); err != nil {
+			t.Fatal(err)
+		}
+		if repo, err = OpenFS(repo.WorkTree(), store); err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("OpenFS() = %v, want ErrCorrupt", err)
+			}
+			return
+		}
+		// Whatever loaded must survive being written back and read again
+		if err = repo.writeIndex(); err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.setHead(repo.branch, repo.head, "test"); err != nil {
+			t.Fatal(err)
+		}
+		reopened, err := OpenFS(repo.WorkTree(), store)
+		if err != nil {
+			t.Fatalf("reopening a rewritten repository: %v", err)
+		}
+		if reopened.head != repo.head || reopened.branch != repo.branch || !reflect.DeepEqual(reopened.Tracked(), repo.Tracked()) {
+			t.Errorf("round trip changed the repository: %+v != %+v", reopened, repo)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package svcs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Head is the revision name of the latest commit.
+const Head = "HEAD"
+
+// minPrefix is the shortest abbreviation of a commit hash accepted as a revision.
+const minPrefix = 4
+
+// Revision is a parsed revision: a commit, given as HEAD, a branch, a
+// (prefix of a) hash or an entry of a reflog such as "HEAD@{2}", and how
+// many generations back from it to go.
+type Revision struct {
+	Base      string
+	Ancestors int
+}
+
+// ParseRevision parses HEAD, a branch name or a hash prefix, optionally
+// followed by @{<n>} for the nth previous value of HEAD or the branch, and
+// then any number of ~<n>, ~ and ^ suffixes, e.g. "HEAD~2", "87428fc5^" or
+// "main@{1}~".
+func ParseRevision(rev string) (Revision, error) {
+	end := strings.IndexAny(rev, "~^")
+	if end < 0 {
+		end = len(rev)
+	}
+	parsed := Revision{Base: rev[:end]}
+	ref, _, isReflog := cutReflog(parsed.Base)
+	if !isReflog {
+		ref = parsed.Base
+	}
+	if ref != Head && !ValidRefName(ref) {
+		return Revision{}, NewError(ErrUnknownRevision, "bad revision '%s'", rev)
+	}
+	for suffix := rev[end:]; suffix != ""; {
+		op := suffix[0]
+		if op != '~' && op != '^' {
+			return Revision{}, NewError(ErrUnknownRevision, "bad revision '%s'", rev)
+		}
+		suffix = suffix[1:]
+		digits := len(suffix) - len(strings.TrimLeft(suffix, "0123456789"))
+		n := 1
+		if digits > 0 {
+			var err error
+			if n, err = strconv.Atoi(suffix[:digits]); err != nil {
+				return Revision{}, NewError(ErrUnknownRevision, "bad revision '%s'", rev)
+			}
+			suffix = suffix[digits:]
+		}
+		if op == '^' && n > 1 {
+			return Revision{}, NewError(ErrUnknownRevision, "bad revision '%s': commit has no parent %d", rev, n)
+		}
+		if parsed.Ancestors+n < parsed.Ancestors {
+			return Revision{}, NewError(ErrUnknownRevision, "bad revision '%s'", rev)
+		}
+		parsed.Ancestors += n
+	}
+	return parsed, nil
+}
+
+func (rev Revision) String() string {
+	if rev.Ancestors == 0 {
+		return rev.Base
+	}
+	return fmt.Sprintf("%s~%d", rev.Base, rev.Ancestors)
+}
+
+// ResolveRevision returns the commit named by rev.
+func (repo *Repository) ResolveRevision(rev string) (*Commit, error) {
+	parsed, err := ParseRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := repo.resolveBase(parsed.Base)
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		return nil, NewError(ErrUnknownRevision, "commit '%s' does not exist", rev)
+	}
+	commit, err := repo.ReadCommit(hash)
+	for i := 0; i < parsed.Ancestors && err == nil; i++ {
+		if len(commit.Parents) == 0 {
+			return nil, NewError(ErrUnknownRevision, "revision '%s' goes back beyond the first commit", rev)
+		}
+		commit, err = repo.ReadCommit(commit.Parents[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return commit, nil
+}
+
+// resolveBase returns the commit id named by HEAD, a branch, a reflog entry
+// or a unique prefix of at least minPrefix hex digits, or "" if there is none.
+func (repo *Repository) resolveBase(base string) (string, error) {
+	if ref, n, ok := cutReflog(base); ok {
+		entries, err := repo.Reflog(ref)
+		if err != nil {
+			return "", err
+		}
+		if n >= len(entries) {
+			return "", NewError(ErrUnknownRevision, "the reflog of %s only has %d entries", ref, len(entries))
+		}
+		return entries[n].New, nil
+	}
+	if base == Head {
+		return repo.head, nil
+	}
+	if hash, err := repo.readRef(branchPath(base)); err != nil || hash != "" {
+		return hash, err
+	}
+	prefix := strings.ToLower(base)
+	if len(prefix) < minPrefix || len(prefix) > idLength || strings.Trim(prefix, "0123456789abcdef") != "" {
+		return "", nil
+	}
+	ids, err := repo.objectIDs(prefix)
+	if err != nil {
+		return "", err
+	}
+	found := ""
+	for _, id := range ids {
+		if _, err := repo.readObject(id, ObjectCommit); err != nil {
+			// Only commits are revisions
+			continue
+		}
+		if found != "" {
+			return "", NewError(ErrUnknownRevision, "revision '%s' is ambiguous", base)
+		}
+		found = id
+	}
+	return found, nil
+}
@@ -0,0 +1,160 @@
+package svcs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRevision(t *testing.T) {
+	tests := []struct {
+		rev     string
+		want    Revision
+		wantErr bool
+	}{
+		{"HEAD", Revision{"HEAD", 0}, false},
+		{"HEAD~", Revision{"HEAD", 1}, false},
+		{"HEAD^", Revision{"HEAD", 1}, false},
+		{"HEAD~3", Revision{"HEAD", 3}, false},
+		{"HEAD^^~2", Revision{"HEAD", 4}, false},
+		{"HEAD^1", Revision{"HEAD", 1}, false},
+		{"87428FC5", Revision{"87428FC5", 0}, false},
+		{"8742~0", Revision{"8742", 0}, false},
+		{"main^", Revision{"main", 1}, false},
+		{"feature/x~2", Revision{"feature/x", 2}, false},
+		{"a..b", Revision{}, true},
+		{"-x", Revision{}, true},
+		{"a b", Revision{}, true},
+		{"HEAD@{1}", Revision{"HEAD@{1}", 0}, false},
+		{"main@{0}~2", Revision{"main@{0}", 2}, false},
+		{"HEAD@{x}", Revision{}, true},
+		{"HEAD@{}", Revision{}, true},
+		{"@{1}", Revision{}, true},
+		{"HEAD^2", Revision{}, true},
+		{"HEAD~x", Revision{}, true},
+		{"~1", Revision{}, true},
+		{"HEAD~99999999999999999999", Revision{}, true},
+		{"", Revision{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRevision(tt.rev)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRevision(%q) error = %v, wantErr %v", tt.rev, err, tt.wantErr)
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrUnknownRevision) {
+			t.Errorf("ParseRevision(%q) error = %v, want ErrUnknownRevision", tt.rev, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseRevision(%q) = %+v, want %+v", tt.rev, got, tt.want)
+		}
+	}
+}
+
+func TestParseRevisionMissingParent(t *testing.T) {
+	_, err := ParseRevision("HEAD^2")
+	want := "bad revision 'HEAD^2': commit has no parent 2"
+	if !errors.Is(err, ErrUnknownRevision) || err.Error() != want {
+		t.Errorf("ParseRevision(\"HEAD^2\") error = %v, want %q", err, want)
+	}
+}
+
+func TestResolveRevision(t *testing.T) {
+	repo := newTestRepository(t)
+	var hashes []string
+	writeFile(t, repo.WorkTree(), "a.txt", "")
+	mustAdd(t, repo, "a.txt")
+	for _, content := range []string{"1", "2", "3"} {
+		writeFile(t, repo.WorkTree(), "a.txt", content)
+		mustAdd(t, repo, "a.txt")
+		hashes = append(hashes, mustCommit(t, repo, content).Hash)
+	}
+	tests := []struct {
+		rev  string
+		want string
+	}{
+		{"HEAD", hashes[2]},
+		{"HEAD~1", hashes[1]},
+		{"HEAD^^", hashes[0]},
+		{"main", hashes[2]},
+		{"main~2", hashes[0]},
+		{hashes[1], hashes[1]},
+		{strings.ToUpper(hashes[1][:6]), hashes[1]},
+		{hashes[2][:6] + "~2", hashes[0]},
+		{"HEAD~3", ""},
+		{"ffffffffff", ""},
+		{"nobranch", ""},
+		{hashes[0] + "0", ""},
+		{"HEAD@{0}", hashes[2]},
+		{"HEAD@{2}", hashes[0]},
+		{"main@{1}", hashes[1]},
+		{"HEAD@{1}~1", hashes[0]},
+		{"HEAD@{3}", ""},
+		{"nobranch@{0}", ""},
+	}
+	for _, tt := range tests {
+		commit, err := repo.ResolveRevision(tt.rev)
+		if tt.want == "" {
+			if !errors.Is(err, ErrUnknownRevision) {
+				t.Errorf("ResolveRevision(%q) = %v, %v, want ErrUnknownRevision", tt.rev, commit, err)
+			}
+			continue
+		}
+		if err != nil || commit.Hash != tt.want {
+			t.Errorf("ResolveRevision(%q) = %v, %v, want %s", tt.rev, commit, err, tt.want)
+		}
+	}
+	// Trees and blobs are not revisions
+	if _, err := repo.ResolveRevision(repo.index.Files[0].Object); !errors.Is(err, ErrUnknownRevision) {
+		t.Errorf("ResolveRevision of a blob = %v, want ErrUnknownRevision", err)
+	}
+}
+
+func TestResolveAmbiguousRevision(t *testing.T) {
+	repo := newTestRepository(t)
+	// Write commits until two of them share their first four digits
+	seen := map[string]string{}
+	for i := 0; ; i++ {
+		commit := &Commit{Tree: "87428fc522803d31065e7bce3cf03fe4", Date: time.Unix(0, 0), Message: strconv.Itoa(i)}
+		if err := repo.writeCommit(commit); err != nil {
+			t.Fatal(err)
+		}
+		prefix := commit.Hash[:minPrefix]
+		other, ok := seen[prefix]
+		if !ok {
+			seen[prefix] = commit.Hash
+			continue
+		}
+		if _, err := repo.ResolveRevision(prefix); !errors.Is(err, ErrUnknownRevision) {
+			t.Errorf("ambiguous prefix %s: got %v, want ErrUnknownRevision", prefix, err)
+		}
+		if found, err := repo.ResolveRevision(other); err != nil || found.Hash != other {
+			t.Errorf("full id %s: got %v, %v", other, found, err)
+		}
+		return
+	}
+}
+
+func FuzzParseRevision(f *testing.F) {
+	for _, seed := range []string{"HEAD", "HEAD~2", "HEAD^^", "87428fc5~1^", "abc", "HEAD~", "HEAD^2"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, rev string) {
+		parsed, err := ParseRevision(rev)
+		if err != nil {
+			if !errors.Is(err, ErrUnknownRevision) {
+				t.Fatalf("ParseRevision(%q) error %v is not ErrUnknownRevision", rev, err)
+			}
+			return
+		}
+		if parsed.Ancestors < 0 {
+			t.Fatalf("ParseRevision(%q) = %+v with negative ancestors", rev, parsed)
+		}
+		again, err := ParseRevision(parsed.String())
+		if err != nil || again != parsed {
+			t.Fatalf("ParseRevision(%q) = %+v, %v, want %+v", parsed.String(), again, err, parsed)
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package svcs
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// File states reported by Status.
+const (
+	StateUnmodified = "unmodified"
+	StateModified   = "modified"
+	StateAdded      = "added"
+	StateDeleted    = "deleted"
+	StateUntracked  = "untracked"
+)
+
+// FileStatus is the state of a file in the index compared with the current
+// commit (Staged) and in the work tree compared with the index (Unstaged).
+// Both are StateUntracked for files that are neither tracked nor committed.
+type FileStatus struct {
+	Path     string `json:"path"`
+	Staged   string `json:"staged"`
+	Unstaged string `json:"unstaged"`
+}
+
+// Status lists the tracked and committed files with their state, and the
+// untracked files of the work tree, sorted by path.
+func (repo *Repository) Status() ([]FileStatus, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	committed, err := repo.treeOf(head)
+	if err != nil {
+		return nil, err
+	}
+	var statuses []FileStatus
+	seen := map[string]bool{}
+	for _, snap := range []snapshot{repo.index, committed} {
+		for _, entry := range snap.Files {
+			if seen[entry.Path] {
+				continue
+			}
+			seen[entry.Path] = true
+			status := FileStatus{entry.Path, StateUnmodified, StateUnmodified}
+			staged, old := repo.index.lookup(entry.Path), committed.lookup(entry.Path)
+			switch {
+			case old == "":
+				status.Staged = StateAdded
+			case staged == "":
+				status.Staged = StateDeleted
+			case staged != old:
+				status.Staged = StateModified
+			}
+			if status.Unstaged, err = repo.workState(entry.Path, staged); err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	err = fs.WalkDir(repo.work, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if name != "." && (name == Dir || strings.HasPrefix(entry.Name(), ".")) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !seen[name] {
+			statuses = append(statuses, FileStatus{name, StateUntracked, StateUntracked})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, ioError(err)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Path < statuses[j].Path
+	})
+	return statuses, nil
+}
+
+// workState compares the work tree file name with the blob, which is empty
+// if the file is not tracked.
+func (repo *Repository) workState(name, blob string) (string, error) {
+	info, err := repo.work.Stat(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && blob == "":
+		return StateUnmodified, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return StateDeleted, nil
+	case err != nil:
+		return "", ioError(err)
+	case blob == "":
+		return StateUntracked, nil
+	}
+	id, err := repo.fileID(name, info.Size())
+	if err != nil {
+		return "", err
+	}
+	if id != blob {
+		return StateModified, nil
+	}
+	return StateUnmodified, nil
+}
+
+// treeOf returns the snapshot of commit, which is empty if commit is nil.
+func (repo *Repository) treeOf(commit *Commit) (snapshot, error) {
+	if commit == nil {
+		return snapshot{}, nil
+	}
+	return repo.readTree(commit.Tree)
+}